@@ -4,6 +4,7 @@ import (
 	"os"
 
 	contact_info "github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/contact-info"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
 	"github.com/mbndr/logo"
 	"github.com/snwfdhmp/errlog"
 	"github.com/spf13/cobra"
@@ -25,11 +26,98 @@ type Config struct {
 	ContactInfo       *contact_info.ContactInfo `mapstructure:"contact_info"`
 	Reseller          string                    `mapstructure:"resseller"`
 	Binding           string                    `mapstructure:"binding"`
+	PortalURL         string                    `mapstructure:"portal_url"`
+	Retry             portal.RetryPolicy        `mapstructure:"retry"`
+	RateLimit         portal.RateLimit          `mapstructure:"rate_limit"`
+	Include           []string                  `mapstructure:"include"`
+	Exclude           []string                  `mapstructure:"exclude"`
+	InventoryFile     string                    `mapstructure:"inventory_file"`
+	Import            Import                    `mapstructure:"import"`
+	Expiry            Expiry                    `mapstructure:"expiry"`
+	Notify            Notify                    `mapstructure:"notify"`
+	SMC               *SMC                      `mapstructure:"smc"`
+}
+
+// SMC is the Security Management Center the licenses are installed on, through
+// its REST API
+type SMC struct {
+	IP                 string `mapstructure:"ip"`
+	Port               int    `mapstructure:"port"`
+	APIKey             string `mapstructure:"api_key"`
+	APIVersion         string `mapstructure:"api_version"`
+	Domain             string `mapstructure:"domain"`
+	TLS                bool   `mapstructure:"tls"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	// MappingFile records the engine node of each PoS/PoL, proposed by
+	// smc-match and used by install
+	MappingFile string `mapstructure:"mapping_file"`
+}
+
+// Notify defines where the changes of the PoS/PoL are sent
+type Notify struct {
+	Webhooks []Webhook `mapstructure:"webhooks"`
+	SMTP     *SMTP     `mapstructure:"smtp"`
+}
+
+// SMTP sends the registration summaries and the expiry digests by email. TLS
+// is none, starttls or tls. Recipients are given by company, the contact_info
+// email being the default one.
+type SMTP struct {
+	Host       string              `mapstructure:"host"`
+	Port       int                 `mapstructure:"port"`
+	TLS        string              `mapstructure:"tls"`
+	Username   string              `mapstructure:"username"`
+	Password   string              `mapstructure:"password"`
+	From       string              `mapstructure:"from"`
+	Recipients map[string][]string `mapstructure:"recipients"`
+}
+
+// Webhook receives the changes of the PoS/PoL as a JSON POST, Format being
+// json, slack or teams. Events restricts the events sent, all by default.
+type Webhook struct {
+	URL    string   `mapstructure:"url"`
+	Format string   `mapstructure:"format"`
+	Events []string `mapstructure:"events"`
+}
+
+// Import maps the columns of the CSV/XLSX files read to PoS, PoL and
+// metadata. Without Metadata, every other column is kept as metadata.
+type Import struct {
+	PoSColumns []string `mapstructure:"pos_columns"`
+	PoLColumns []string `mapstructure:"pol_columns"`
+	// Metadata gives the column header of each metadata key
+	Metadata map[string]string `mapstructure:"metadata"`
+	// Sheet is the XLSX sheet read, the first one when empty
+	Sheet string `mapstructure:"sheet"`
+}
+
+var DefaultImport = Import{
+	PoSColumns: []string{"PoS", "Proof of Serial"},
+	PoLColumns: []string{"PoL", "Proof of License"},
+}
+
+// Expiry defines the horizons of the expiring command, in days
+type Expiry struct {
+	Horizons     []int `mapstructure:"horizons"`
+	CriticalDays int   `mapstructure:"critical_days"`
+}
+
+var DefaultExpiry = Expiry{
+	Horizons:     []int{30, 60, 90},
+	CriticalDays: 30,
 }
 
 //=================================================================
 // Config
 
+// DefaultInventoryFile is where every PoS/PoL seen is recorded, an empty
+// inventory_file disables the inventory
+const DefaultInventoryFile = "inventory.json"
+
+// DefaultMappingFile is where the engine node of each PoS/PoL is recorded when
+// smc.mapping_file is not set
+const DefaultMappingFile = "smc-mapping.json"
+
 var (
 	ConfigFile string
 	Cfg        = Config{}
@@ -73,6 +161,19 @@ func readConfig() {
 	viper.SetConfigType("yaml")
 
 	viper.SetDefault("contact_info", nil)
+	viper.SetDefault("portal_url", portal.DefaultBaseURL)
+	viper.SetDefault("retry.max_attempts", portal.DefaultRetryPolicy.MaxAttempts)
+	viper.SetDefault("retry.initial_interval", portal.DefaultRetryPolicy.InitialInterval)
+	viper.SetDefault("retry.max_interval", portal.DefaultRetryPolicy.MaxInterval)
+	viper.SetDefault("retry.multiplier", portal.DefaultRetryPolicy.Multiplier)
+	viper.SetDefault("retry.jitter", portal.DefaultRetryPolicy.Jitter)
+	viper.SetDefault("rate_limit.requests_per_second", portal.DefaultRateLimit.RequestsPerSecond)
+	viper.SetDefault("rate_limit.burst", portal.DefaultRateLimit.Burst)
+	viper.SetDefault("inventory_file", DefaultInventoryFile)
+	viper.SetDefault("import.pos_columns", DefaultImport.PoSColumns)
+	viper.SetDefault("import.pol_columns", DefaultImport.PoLColumns)
+	viper.SetDefault("expiry.horizons", DefaultExpiry.Horizons)
+	viper.SetDefault("expiry.critical_days", DefaultExpiry.CriticalDays)
 
 	viper.ReadInConfig()
 
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Newlode/forcepoint-ngfw-licenses/codes"
 	"github.com/Newlode/forcepoint-ngfw-licenses/config"
 	ngfwlicenses "github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/inventory"
+	license_file "github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/license-file"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/notify"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
 	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/smc"
 	"github.com/logrusorgru/aurora"
 	"github.com/mbndr/logo"
 	"github.com/spf13/cobra"
@@ -40,15 +51,45 @@ Written by Newlode https://www.newlode.io
 				logger.Fatalf("--pos-only and --pol-only are mutually exclusive")
 			}
 
-			poxList = pox.ReadPoXFormArgs(args, polOnly, posOnly)
+			pox.Portal = portal.NewPortal(cfg.PortalURL, cfg.Retry, cfg.RateLimit)
+
+			var err error
+			poxList, err = pox.ReadPoXFormArgs(args, posOnly, polOnly)
+			if err != nil {
+				logger.Fatalf("%v", err)
+			}
+
+			openInventory()
+			if fromInventory {
+				if inv == nil {
+					logger.Fatalf("--from-inventory requires an inventory_file")
+				}
+				poxList = appendPoX(poxList, inv.PoXList(), "inventory")
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			finish()
+			if strict {
+				for _, report := range reports {
+					if err := report.Err(); err != nil {
+						logger.Fatalf("%v", err)
+					}
+				}
+			}
 		},
 	}
 
 	poxList pox.PoXList
-
-	verifyFormat string
-	posOnly      bool
-	polOnly      bool
+	reports []*pox.Report
+	inv     *inventory.Inventory
+
+	verifyFormat  string
+	posOnly       bool
+	polOnly       bool
+	reportFile    string
+	strict        bool
+	fromInventory bool
+	dryRun        bool
 )
 
 func init() {
@@ -56,6 +97,7 @@ func init() {
 	ngfwlicenses.Logger = config.GetNewLogger(aurora.Magenta("NGFWLIC").String())
 	pox.Logger = config.GetNewLogger(aurora.Green("POX   ").String())
 	config.Logger = config.GetNewLogger(aurora.Red("CONFIG").String())
+	smc.Logger = config.GetNewLogger(aurora.Yellow("SMC   ").String())
 
 	// ConfigFile
 	rootCmd.PersistentFlags().StringVarP(&config.ConfigFile, "config", "c", "", "config file (default is config.yml in current directory)")
@@ -64,6 +106,12 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&posOnly, "pos-only", false, "PoS only")
 	rootCmd.PersistentFlags().BoolVar(&polOnly, "pol-only", false, "PoL-only")
 
+	// Include / Exclude
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Include, "include", nil, "Globs of the files to read in the directories given as arguments (default all)")
+	viper.BindPFlag("include", rootCmd.PersistentFlags().Lookup("include"))
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Exclude, "exclude", nil, "Globs of the files and directories to skip in the directories given as arguments")
+	viper.BindPFlag("exclude", rootCmd.PersistentFlags().Lookup("exclude"))
+
 	// Debug / Verbose
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Debug, "debug", "d", false, "Enable debug output")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Enable verbose output")
@@ -76,6 +124,19 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfg.LicensesOutputDir, "output-dir", "jar-files", "The directory where to store licenses files")
 	viper.BindPFlag("licenses_output_dir", rootCmd.PersistentFlags().Lookup("output-dir"))
 
+	// PortalURL
+	rootCmd.PersistentFlags().StringVar(&cfg.PortalURL, "portal-url", portal.DefaultBaseURL, "Base URL of the license portal")
+	viper.BindPFlag("portal_url", rootCmd.PersistentFlags().Lookup("portal-url"))
+
+	// Reports
+	rootCmd.PersistentFlags().StringVar(&reportFile, "report-file", "", "Write the per PoS/PoL results of the operations to this JSON file")
+	rootCmd.PersistentFlags().BoolVar(&strict, "strict", false, "Exit with an error when an operation failed on some PoS/PoL")
+
+	// Inventory
+	rootCmd.PersistentFlags().StringVar(&cfg.InventoryFile, "inventory-file", config.DefaultInventoryFile, "The file where every PoS/PoL seen is recorded, empty to disable it")
+	viper.BindPFlag("inventory_file", rootCmd.PersistentFlags().Lookup("inventory-file"))
+	rootCmd.PersistentFlags().BoolVar(&fromInventory, "from-inventory", false, "Add every PoS/PoL from the inventory to the ones given as arguments")
+
 }
 
 //=================================================================
@@ -115,23 +176,21 @@ func runListCountryStates(cmd *cobra.Command, args []string) {
 
 // runVerify just check online the PoS status
 func runVerify(cmd *cobra.Command, args []string) {
-	poxList.RefreshStatus()
+	checkError(poxList.RefreshStatus(cmd.Context()))
 	switch verifyFormat {
 	case "json":
-		obj := struct {
-			PoLList pox.PoXList `json:"pol_list,omitempty"`
-			PoSList pox.PoXList `json:"pos_list,omitempty"`
-		}{
-			PoLList: poxList.GetAllPoL(),
-			PoSList: poxList.GetAllPoS(),
-		}
-		out, _ := json.MarshalIndent(obj, "", "  ")
+		out, _ := json.MarshalIndent(poxList.Snapshot(), "", "  ")
 		fmt.Println(string(out))
 	case "csv":
 		w := csv.NewWriter(os.Stdout)
-		w.Write([]string{"PoS", "PoL", "LicenseStatus", "LicenseID", "ProductName", "Binding", "Platform", "LicensePeriod", "SerialNumber", "MaintenanceStatus", "MaintenanceEndDate", "Company"})
+		// metadata read from CSV/XLSX files are the last columns
+		metadataKeys := poxList.MetadataKeys()
+		w.Write(append([]string{"PoS", "PoL", "LicenseStatus", "LicenseID", "ProductName", "Binding", "Platform", "LicensePeriod", "SerialNumber", "MaintenanceStatus", "MaintenanceEndDate", "Company"}, metadataKeys...))
 		for _, r := range poxList {
 			line := []string{r.PoS, r.PoL, string(r.Status), r.LicenseID, r.ProductName, r.Binding, r.Platform, r.LicensePeriod, r.SerialNumber, string(r.MaintenanceStatus), r.MaintenanceEndDate, r.Company}
+			for _, k := range metadataKeys {
+				line = append(line, r.Metadata[k])
+			}
 			if err := w.Write(line); err != nil {
 				log.Fatalln("error writing record to csv:", err)
 			}
@@ -142,37 +201,534 @@ func runVerify(cmd *cobra.Command, args []string) {
 	}
 }
 
+// runHistory displays the timeline of a PoS/PoL recorded in the inventory
+func runHistory(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	cfg.Silent = format == "json"
+
+	openInventory()
+	if inv == nil {
+		logger.Fatalf("history requires an inventory_file")
+	}
+	entry := inv.Get(args[0])
+	if entry == nil {
+		logger.Fatalf("%s not found in inventory %s", args[0], cfg.InventoryFile)
+	}
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(entry, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	entry.DisplayHistory()
+}
+
+// runInspect displays the content of license files, and checks them against
+// their PoS/PoL when the inventory knows it
+func runInspect(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	cfg.Silent = format == "json"
+
+	openInventory()
+
+	type inspected struct {
+		*license_file.LicenseFile
+		PoX        string `json:"pox,omitempty"`
+		CheckError string `json:"check_error,omitempty"`
+	}
+	res := make([]inspected, 0, len(args))
+	failed := 0
+	for _, filename := range args {
+		lf, err := license_file.Open(filename)
+		if err != nil {
+			logger.Errorf("%v", err)
+			failed++
+			continue
+		}
+
+		i := inspected{LicenseFile: lf}
+		unchecked := false
+		if p := licenseFilePoX(lf); p != nil {
+			i.PoX = p.Identifier()
+			if err := p.CheckLicenseFile(lf); err != nil {
+				i.CheckError = err.Error()
+				// the properties are a best guess, their absence is not an error
+				unchecked = errors.Is(err, license_file.ErrMissingProperties)
+				if !unchecked {
+					failed++
+				}
+			}
+		}
+		res = append(res, i)
+
+		if format != "json" {
+			lf.Display()
+			switch {
+			case unchecked:
+				fmt.Printf("  PoS/PoL:         %s %s\n", i.PoX, aurora.Yellow("not checked, "+i.CheckError))
+			case i.CheckError != "":
+				fmt.Printf("  PoS/PoL:         %s %s\n", i.PoX, aurora.Red(i.CheckError))
+			case i.PoX != "":
+				fmt.Printf("  PoS/PoL:         %s %s\n", i.PoX, aurora.Green("matches"))
+			}
+		}
+	}
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(out))
+	}
+	if failed > 0 {
+		finish()
+		logger.Errorf("%d invalid license files", failed)
+		os.Exit(1)
+	}
+}
+
+// licenseFilePoX returns the PoS/PoL of the inventory a license file has been
+// downloaded for
+func licenseFilePoX(lf *license_file.LicenseFile) *pox.PoX {
+	if inv == nil {
+		return nil
+	}
+	for _, p := range inv.PoXList() {
+		if (p.LicenseFile != "" && p.LicenseFile == lf.Name) || (p.LicenseID != "" && p.LicenseID == lf.LicenseID) {
+			return p
+		}
+	}
+	return nil
+}
+
+// runLint reports the strings of the arguments which look almost like a
+// PoS/PoL, without loading anything from the license portal
+func runLint(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	cfg.Silent = format == "json"
+
+	lints, err := pox.LintArgs(args, posOnly, polOnly)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(lints, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		lints.Display()
+	}
+	if len(lints) > 0 {
+		finish()
+		os.Exit(1)
+	}
+}
+
+// runDiff compares two snapshots, each one being a file written by
+// verify --format json, or the inventory at a given date
+func runDiff(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	cfg.Silent = format == "json"
+
+	diff := pox.NewDiff(readSnapshot(args[0]), readSnapshot(args[1]))
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(diff, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	diff.Display()
+}
+
+// snapshotTimeFormats are the formats of the dates accepted by diff, a date
+// without time being the end of that day
+var snapshotTimeFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// readSnapshot reads a snapshot file, or the inventory at the date given by arg
+func readSnapshot(arg string) pox.PoXList {
+	t, isDate := parseSnapshotTime(arg)
+	if !isDate {
+		poxList, err := pox.ReadSnapshot(arg)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return poxList
+	}
+
+	openInventory()
+	if inv == nil {
+		logger.Fatalf("diff on dates requires an inventory_file")
+	}
+	return inv.At(t)
+}
+
+func parseSnapshotTime(arg string) (time.Time, bool) {
+	if arg == "now" {
+		return time.Now(), true
+	}
+	for _, format := range snapshotTimeFormats {
+		if t, err := time.ParseInLocation(format, arg, time.Local); err == nil {
+			if format == "2006-01-02" {
+				t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// runExpiring lists the PoS/PoL whose support ends soon, and exits with an
+// error when some are inside the critical window, supports already ended are
+// listed apart and do not count
+func runExpiring(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	noRefresh, _ := cmd.Flags().GetBool("no-refresh")
+	if cmd.Flags().Changed("horizons") {
+		cfg.Expiry.Horizons, _ = cmd.Flags().GetIntSlice("horizons")
+	}
+	if cmd.Flags().Changed("critical-days") {
+		cfg.Expiry.CriticalDays, _ = cmd.Flags().GetInt("critical-days")
+	}
+
+	if noRefresh {
+		if inv == nil {
+			logger.Fatalf("--no-refresh requires an inventory_file")
+		}
+		if missing := inv.Fill(poxList); len(missing) > 0 {
+			logger.Warnf("%d PoS/PoL not found in the inventory, their support end is unknown", len(missing))
+		}
+	} else {
+		checkError(poxList.RefreshStatus(cmd.Context()))
+	}
+	report := poxList.Expiring(time.Now(), cfg.Expiry.Horizons, cfg.Expiry.CriticalDays)
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		report.Display()
+	}
+
+	if mailer := newMailer(); mailer != nil && report.Count()+report.CountExpired() > 0 {
+		if err := mailer.SendExpiryDigest(report); err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
+
+	if critical := report.Critical(); len(critical) > 0 {
+		finish()
+		logger.Errorf("%d PoS/PoL support ending within %d days", len(critical), cfg.Expiry.CriticalDays)
+		os.Exit(1)
+	}
+}
+
 // runRegister
 func runRegister(cmd *cobra.Command, args []string) {
-	poxList.RefreshStatus()
+	checkError(poxList.RefreshStatus(cmd.Context()))
 	poxList.Display()
-	poxList.Register()
+	checkError(poxList.Register(cmd.Context()))
 	poxList.Display()
 }
 
 // runDownload
 func runDownload(cmd *cobra.Command, args []string) {
-	poxList.RefreshStatus()
+	checkError(poxList.RefreshStatus(cmd.Context()))
 	poxList.Display()
-	poxList.Register()
-	poxList.Download()
+	checkError(poxList.Register(cmd.Context()))
+	checkError(poxList.Download(cmd.Context()))
 }
 
 // runDownloadOnly
 func runDownloadOnly(cmd *cobra.Command, args []string) {
-	poxList.RefreshStatus()
+	checkError(poxList.RefreshStatus(cmd.Context()))
 	poxList.Display()
-	poxList.Download()
+	checkError(poxList.Download(cmd.Context()))
 }
 
 // runChangeBinding
 func runChangeBinding(cmd *cobra.Command, args []string) {
-	poxList.RefreshStatus()
-	poxList.ChangeBinding()
+	checkError(poxList.RefreshStatus(cmd.Context()))
+	checkError(poxList.ChangeBinding(cmd.Context()))
 	// poxList.RefreshStatus()
 	poxList.Display()
 }
 
+// runInstall
+func runInstall(cmd *cobra.Command, args []string) {
+	// registrations cannot be undone: a dry-run plans the installation from
+	// the license files already downloaded, as install-only does
+	if dryRun {
+		if !cfg.Silent {
+			fmt.Printf("Dry-run: PoS/PoL are neither registered nor downloaded, the license files already in './%s/' are installed\n", cfg.LicensesOutputDir)
+		}
+		runInstallOnly(cmd, args)
+		return
+	}
+	runDownload(cmd, args)
+	installOnSMC(cmd.Context())
+}
+
+// runInstallOnly
+func runInstallOnly(cmd *cobra.Command, args []string) {
+	checkError(poxList.RefreshStatus(cmd.Context()))
+	poxList.Display()
+	installOnSMC(cmd.Context())
+}
+
+// runSMCMatch
+func runSMCMatch(cmd *cobra.Command, args []string) {
+	checkError(poxList.RefreshStatus(cmd.Context()))
+
+	client := newSMCClient(cmd.Context())
+	engines, err := client.Engines(cmd.Context())
+	if err := client.Logout(context.Background()); err != nil {
+		logger.Warnf("%v", err)
+	}
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	previous, err := smc.ReadMapping(mappingFile())
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	mapping := smc.NewMapping(engines, poxList)
+	mapping.Merge(previous)
+
+	if !cfg.Silent {
+		mapping.Display()
+	}
+	if err := mapping.Save(mappingFile()); err != nil {
+		logger.Fatalf("unable to save mapping: %v", err)
+	}
+	if !cfg.Silent {
+		fmt.Printf("\nMapping saved in %s\n", mappingFile())
+	}
+}
+
+// runSMCAudit
+func runSMCAudit(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+
+	client := newSMCClient(cmd.Context())
+	licenses, err := client.Licenses(cmd.Context())
+	if err := client.Logout(context.Background()); err != nil {
+		logger.Warnf("%v", err)
+	}
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	// the PoS/PoL of the installed licenses are loaded from the portal as well
+	poxList = appendPoX(poxList, smc.LicensePoX(licenses), "SMC licenses")
+	checkError(poxList.RefreshStatus(cmd.Context()))
+	audit := smc.NewAudit(licenses, poxList, time.Now())
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(audit, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		audit.Display()
+	}
+
+	if err := audit.Err(); err != nil {
+		finish()
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+}
+
+// mappingFile returns where the engine node of each PoS/PoL is recorded
+func mappingFile() string {
+	if cfg.SMC != nil && cfg.SMC.MappingFile != "" {
+		return cfg.SMC.MappingFile
+	}
+	return config.DefaultMappingFile
+}
+
+// newSMCClient returns a client logged in the SMC
+func newSMCClient(ctx context.Context) *smc.Client {
+	client, err := smc.NewClient(cfg.SMC)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	client.DryRun = dryRun
+	if err := client.Login(ctx); err != nil {
+		logger.Fatalf("%v", err)
+	}
+	return client
+}
+
+// installOnSMC installs the downloaded license files on the SMC
+func installOnSMC(ctx context.Context) {
+	mapping, err := smc.ReadMapping(mappingFile())
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	client := newSMCClient(ctx)
+	report, err := smc.Install(ctx, client, poxList, cfg.LicensesOutputDir, mapping)
+	if err := client.Logout(context.Background()); err != nil {
+		logger.Warnf("%v", err)
+	}
+
+	if report != nil && !cfg.Silent {
+		if dryRun {
+			fmt.Printf("Dry-run: %d license files would have been installed or bound on the SMC\n", len(report.Changed()))
+		} else {
+			fmt.Printf("%d license files have been installed or bound on the SMC\n", len(report.Changed()))
+		}
+	}
+	checkError(report, err)
+}
+
+// checkError records the report returned by PoXList methods and stops the
+// program on errors, errors on a single PoS/PoL are not returned, they are
+// part of the report
+func checkError(report *pox.Report, err error) {
+	if report != nil {
+		reports = append(reports, report)
+		if !cfg.Silent {
+			report.Display()
+		}
+	}
+	if errors.Is(err, pox.ErrInterrupted) {
+		finish()
+		logger.Warnf("%v", err)
+		os.Exit(130)
+	}
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+}
+
+// finish records what has been done, it is called when a command completes or
+// is interrupted. The state before the operations, when unknown, is the last
+// one from the inventory.
+func finish() {
+	if inv != nil {
+		inv.Seed(reports...)
+	}
+	writeReports()
+	saveInventory()
+	sendNotifications()
+}
+
+// sendNotifications sends the changes seen by the operations to the webhooks,
+// and the registration summary by email
+func sendNotifications() {
+	if mailer := newMailer(); mailer != nil {
+		if err := mailer.SendSummary(reports...); err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
+
+	if len(cfg.Notify.Webhooks) == 0 {
+		return
+	}
+	events := notify.Events(reports...)
+	if len(events) == 0 {
+		return
+	}
+	logger.Infof("Sending %d events to %d webhooks", len(events), len(cfg.Notify.Webhooks))
+	if err := notify.Send(context.Background(), cfg.Notify.Webhooks, events); err != nil {
+		logger.Errorf("%v", err)
+	}
+}
+
+// newMailer returns the Mailer from config file, or nil when emails are disabled
+func newMailer() *notify.Mailer {
+	if cfg.Notify.SMTP == nil {
+		return nil
+	}
+
+	defaultRecipient := ""
+	if cfg.ContactInfo != nil {
+		defaultRecipient = cfg.ContactInfo.Email
+	}
+	mailer, err := notify.NewMailer(*cfg.Notify.SMTP, defaultRecipient)
+	if err != nil {
+		logger.Errorf("%v", err)
+		return nil
+	}
+	return mailer
+}
+
+// openInventory opens the inventory, unless it is disabled
+func openInventory() {
+	if cfg.InventoryFile == "" {
+		return
+	}
+
+	var err error
+	inv, err = inventory.Open(cfg.InventoryFile)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	for _, id := range inv.Merged {
+		logger.Warnf("%s recorded under several cases in %s, the entries have been merged", id, cfg.InventoryFile)
+	}
+}
+
+// saveInventory records the PoS/PoL processed into the inventory
+func saveInventory() {
+	if inv == nil || len(poxList) == 0 {
+		return
+	}
+	inv.Record(reports...)
+	inv.Update(poxList, time.Now())
+	if err := inv.Save(); err != nil {
+		logger.Errorf("%v", err)
+	}
+}
+
+// appendPoX appends to poxList the PoS/PoL of others it does not contain yet,
+// following --pos-only and --pol-only, origin tells where others come from
+func appendPoX(poxList, others pox.PoXList, origin string) pox.PoXList {
+	known := make(map[string]bool)
+	for _, p := range poxList {
+		known[p.Identifier()] = true
+	}
+	for _, p := range others {
+		if known[p.Identifier()] || (posOnly && p.Type() != pox.PoS) || (polOnly && p.Type() != pox.PoL) {
+			continue
+		}
+		poxList = append(poxList, p)
+	}
+
+	if !cfg.Silent {
+		fmt.Printf("%d PoL and %d PoS to process, %s included\n", len(poxList.GetAllPoL()), len(poxList.GetAllPoS()), origin)
+	}
+	return poxList
+}
+
+// writeReports writes the reports of the operations run so far to --report-file
+func writeReports() {
+	if reportFile == "" || len(reports) == 0 {
+		return
+	}
+	out, _ := json.MarshalIndent(reports, "", "  ")
+	if err := ioutil.WriteFile(reportFile, out, 0644); err != nil {
+		logger.Errorf("unable to write report file: %v", err)
+	}
+}
+
+// interruptContext returns a context cancelled on the first SIGINT/SIGTERM,
+// letting PoS/PoL being processed complete, the second one exits immediately
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		logger.Warnf("Interrupted, waiting for PoS/PoL being processed, interrupt again to exit now")
+		cancel()
+		<-sig
+		os.Exit(130)
+	}()
+
+	return ctx
+}
+
 // runNotImplemented
 /*
 func runNotImplemented(cmd *cobra.Command, args []string) {
@@ -212,6 +768,53 @@ func main() {
 	}
 	cmdVerify.Flags().StringVarP(&verifyFormat, "format", "f", "none", "Choose a specific output format [none|csv|json]")
 
+	var cmdHistory = &cobra.Command{
+		Use:              "history [pos|pol]",
+		Short:            "Display the status history of a PoS/PoL recorded in the inventory",
+		Args:             cobra.ExactArgs(1),
+		Run:              runHistory,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+	cmdHistory.Flags().StringP("format", "f", "none", "Choose a specific output format [none|json]")
+
+	var cmdInspect = &cobra.Command{
+		Use:              "inspect [file.jar]...",
+		Short:            "Display the content of license files, and check them against their PoS/PoL from the inventory",
+		Args:             cobra.MinimumNArgs(1),
+		Run:              runInspect,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+	cmdInspect.Flags().StringP("format", "f", "none", "Choose a specific output format [none|json]")
+
+	var cmdLint = &cobra.Command{
+		Use:              "lint",
+		Short:            "Report the strings which look almost like a PoS/PoL in the arguments, with suggested corrections",
+		Args:             cobra.ArbitraryArgs,
+		Run:              runLint,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+	cmdLint.Flags().StringP("format", "f", "none", "Choose a specific output format [none|json]")
+
+	var cmdDiff = &cobra.Command{
+		Use:              "diff [old] [new]",
+		Short:            "Compare two verify --format json files, or the inventory at two dates (YYYY-MM-DD, or now)",
+		Args:             cobra.ExactArgs(2),
+		Run:              runDiff,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+	cmdDiff.Flags().StringP("format", "f", "none", "Choose a specific output format [none|json]")
+
+	var cmdExpiring = &cobra.Command{
+		Use:   "expiring",
+		Short: "List PoS whose support ends soon, grouped by company and product",
+		Args:  cobra.ArbitraryArgs,
+		Run:   runExpiring,
+	}
+	cmdExpiring.Flags().StringP("format", "f", "none", "Choose a specific output format [none|json]")
+	cmdExpiring.Flags().IntSlice("horizons", config.DefaultExpiry.Horizons, "Horizons, in days")
+	cmdExpiring.Flags().Int("critical-days", config.DefaultExpiry.CriticalDays, "Exit with an error when some support ends within this number of days")
+	cmdExpiring.Flags().Bool("no-refresh", false, "Use the PoS/PoL status from the inventory, without loading them from the license portal")
+
 	var cmdRegister = &cobra.Command{
 		Use:    "register",
 		Short:  "Verify and register all PoS",
@@ -243,33 +846,50 @@ func main() {
 		Run:   runChangeBinding,
 	}
 
-	/*
-		var cmdInstall = &cobra.Command{
-			Use:              "install",
-			Short:            "Verify, register and download licenses on SMC for all PoS",
-			Args:             cobra.NoArgs,
-			Run:              runNotImplemented,
-			PersistentPreRun: func(cmd *cobra.Command, args []string) {},
-		}
-	*/
-
-	/*
-		var cmdInstallOnly = &cobra.Command{
-			Use:              "install-only",
-			Short:            "Verify and install licenses on SMC for already registered PoS",
-			Args:             cobra.NoArgs,
-			Run:              runNotImplemented,
-			PersistentPreRun: func(cmd *cobra.Command, args []string) {},
-		}
-	*/
+	var cmdInstall = &cobra.Command{
+		Use:   "install",
+		Short: "Verify, register and download licenses on SMC for all PoS",
+		Args:  cobra.ArbitraryArgs,
+		Run:   runInstall,
+	}
+	cmdInstall.Flags().BoolVar(&dryRun, "dry-run", false, "Display the licenses to install on the SMC, from the license files already downloaded, without registering nor installing them")
+
+	var cmdInstallOnly = &cobra.Command{
+		Use:   "install-only",
+		Short: "Verify and install licenses on SMC for already registered PoS",
+		Args:  cobra.ArbitraryArgs,
+		Run:   runInstallOnly,
+	}
+	cmdInstallOnly.Flags().BoolVar(&dryRun, "dry-run", false, "Display the licenses to install on the SMC without installing them")
+
+	var cmdSMCMatch = &cobra.Command{
+		Use:   "smc-match",
+		Short: "Propose the SMC engine node of each PoS/PoL, and save the mapping used by install",
+		Args:  cobra.ArbitraryArgs,
+		Run:   runSMCMatch,
+	}
+
+	var cmdSMCAudit = &cobra.Command{
+		Use:   "smc-audit",
+		Short: "Compare the licenses installed on the SMC with the license portal, without changing anything",
+		Args:  cobra.ArbitraryArgs,
+		Run:   runSMCAudit,
+	}
+	cmdSMCAudit.Flags().StringP("format", "f", "none", "Choose a specific output format [none|json]")
 
 	rootCmd.AddCommand(
 		cmdListCountries, cmdListCountryStates,
 		cmdVerify,
+		cmdHistory,
+		cmdInspect,
+		cmdLint,
+		cmdDiff,
+		cmdExpiring,
 		cmdRegister,
 		cmdDownload, cmdDownloadOnly,
 		cmdChangeBinding,
-		//* cmdInstall, cmdInstallOnly,
+		cmdSMCMatch, cmdSMCAudit,
+		cmdInstall, cmdInstallOnly,
 	)
-	rootCmd.Execute()
+	rootCmd.ExecuteContext(interruptContext())
 }
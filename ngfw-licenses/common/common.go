@@ -1,11 +1,14 @@
 package common
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/foolin/pagser"
@@ -27,11 +30,16 @@ func NewPagser() *pagser.Pagser {
 	return p
 }
 
+// ExtractLicenseID returns the 4th word of the node, as in "License ID : 123456"
 func ExtractLicenseID(node *goquery.Selection, args ...string) (out interface{}, err error) {
-	if node.Text() == "" {
+	fields := strings.Fields(node.Text())
+	if len(fields) == 0 {
 		return "", nil
 	}
-	return strings.Split(node.Text(), " ")[3], nil
+	if len(fields) < 4 {
+		return "", fmt.Errorf("unable to extract license ID from %q", node.Text())
+	}
+	return fields[3], nil
 }
 
 func ToUpper(node *goquery.Selection, args ...string) (out interface{}, err error) {
@@ -49,3 +57,23 @@ func Min(x, y int) int {
 	}
 	return y
 }
+
+// ==== Context ====
+
+type detachedContext struct {
+	parent context.Context
+}
+
+// Detach returns a context carrying the values of ctx, but which is never
+// cancelled, for work which has to be completed once started
+func Detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
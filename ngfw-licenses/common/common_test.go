@@ -0,0 +1,37 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractLicenseID(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		want    string
+		wantErr bool
+	}{
+		{"license ID", "<h3>License ID : 700001</h3>", "700001", false},
+		{"extra whitespace", "<h3>\n  License ID :\n  700001\n</h3>", "700001", false},
+		{"empty", "<h3></h3>", "", false},
+		{"unexpected markup", "<h3>700001</h3>", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ExtractLicenseID(doc.Find("h3"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractLicenseID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractLicenseID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// History
+
+// Record is the tracked part of a PoS/PoL at a point in time
+type Record struct {
+	Time               time.Time              `json:"time"`
+	Status             statutes.LicenseStatus `json:"licence_status"`
+	Binding            string                 `json:"binding,omitempty"`
+	MaintenanceStatus  statutes.SupportStatus `json:"support_status,omitempty"`
+	MaintenanceEndDate string                 `json:"support_end_date,omitempty"`
+	SerialNumber       string                 `json:"serial_number,omitempty"`
+	Company            string                 `json:"company,omitempty"`
+}
+
+func newRecord(p *pox.PoX, now time.Time) Record {
+	return Record{
+		Time:               now,
+		Status:             p.Status,
+		Binding:            p.Binding,
+		MaintenanceStatus:  p.MaintenanceStatus,
+		MaintenanceEndDate: p.MaintenanceEndDate,
+		SerialNumber:       p.SerialNumber,
+		Company:            p.Company,
+	}
+}
+
+// apply sets the tracked fields of p to the recorded ones
+func (r Record) apply(p *pox.PoX) {
+	p.Status = r.Status
+	p.Binding = r.Binding
+	p.MaintenanceStatus = r.MaintenanceStatus
+	p.MaintenanceEndDate = r.MaintenanceEndDate
+	p.SerialNumber = r.SerialNumber
+	p.Company = r.Company
+}
+
+// sameAs tells if r and other only differ by their time
+func (r Record) sameAs(other Record) bool {
+	other.Time = r.Time
+	return r == other
+}
+
+// changes describes what changed from prev to r
+func (r Record) changes(prev Record) []string {
+	res := make([]string, 0)
+	if r.Status != prev.Status {
+		res = append(res, fmt.Sprintf("status %s -> %s", prev.Status, aurora.Green(r.Status)))
+	}
+	if r.Binding != prev.Binding {
+		res = append(res, fmt.Sprintf("binding %q -> %q", prev.Binding, r.Binding))
+	}
+	if r.MaintenanceStatus != prev.MaintenanceStatus {
+		res = append(res, fmt.Sprintf("support %s -> %s", prev.MaintenanceStatus, r.MaintenanceStatus))
+	}
+	if r.MaintenanceEndDate != prev.MaintenanceEndDate {
+		res = append(res, fmt.Sprintf("support end date %s -> %s", prev.MaintenanceEndDate, r.MaintenanceEndDate))
+	}
+	if r.SerialNumber != prev.SerialNumber {
+		res = append(res, fmt.Sprintf("SN %q -> %q", prev.SerialNumber, r.SerialNumber))
+	}
+	if r.Company != prev.Company {
+		res = append(res, fmt.Sprintf("company %q -> %q", prev.Company, r.Company))
+	}
+	return res
+}
+
+func (r Record) String() string {
+	res := fmt.Sprintf(`LicenseStatus:"%s"`, aurora.Green(r.Status))
+	if r.Binding != "" {
+		res += fmt.Sprintf(`, Binding:"%s"`, aurora.Gray(12, r.Binding))
+	}
+	if r.MaintenanceStatus != "" {
+		res += fmt.Sprintf(`, MaintenanceStatus:"%s", MaintenanceEndDate:"%s"`, r.MaintenanceStatus, aurora.Gray(12, r.MaintenanceEndDate))
+	}
+	if r.SerialNumber != "" {
+		res += fmt.Sprintf(`, SN:"%s"`, aurora.Gray(12, r.SerialNumber))
+	}
+	if r.Company != "" {
+		res += fmt.Sprintf(`, Company:"%s"`, aurora.Gray(12, r.Company))
+	}
+	return res
+}
+
+// record appends the current state of the entry PoX to its history, when it
+// changed since the last record
+func (e *Entry) record(now time.Time) {
+	e.add(newRecord(e.PoX, now))
+}
+
+// add appends rec to the history, when it differs from the last record
+func (e *Entry) add(rec Record) {
+	if n := len(e.History); n > 0 && e.History[n-1].sameAs(rec) {
+		return
+	}
+	e.History = append(e.History, rec)
+}
+
+// stateRecord returns the record of p in the state seen by an operation
+func stateRecord(p *pox.PoX, state pox.State, t time.Time) Record {
+	rec := newRecord(p, t)
+	rec.Status = state.Status
+	rec.Binding = state.Binding
+	rec.MaintenanceStatus = state.MaintenanceStatus
+	rec.MaintenanceEndDate = state.MaintenanceEndDate
+	return rec
+}
+
+// Record records in the history every state the PoS/PoL went through during
+// the operations of reports, in their order: the state before each operation
+// at its start, and the one after it at its end. Update records the final
+// state.
+func (inv *Inventory) Record(reports ...*pox.Report) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for _, report := range reports {
+		if report == nil {
+			continue
+		}
+		end := report.Start.Add(report.Duration)
+		for _, r := range report.Results {
+			if r.Skipped {
+				continue
+			}
+			entry, ok := inv.Entries[r.PoX.Identifier()]
+			if !ok {
+				latest := *r.PoX
+				entry = &Entry{FirstSeen: report.Start, LastSeen: report.Start, PoX: &latest}
+				inv.Entries[r.PoX.Identifier()] = entry
+			}
+			if known(r.Before.Status) {
+				entry.add(stateRecord(r.PoX, r.Before, report.Start))
+			}
+			if r.Err == nil && known(r.After.Status) {
+				entry.add(stateRecord(r.PoX, r.After, end))
+			}
+		}
+	}
+}
+
+// Seed sets the state before the operations of reports, when it is unknown, to
+// the last one recorded in the history: the changes since the previous run are
+// then seen as changes. It is to be called before Record and Update.
+func (inv *Inventory) Seed(reports ...*pox.Report) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for _, report := range reports {
+		if report == nil {
+			continue
+		}
+		for i, r := range report.Results {
+			if known(r.Before.Status) {
+				continue
+			}
+			entry, ok := inv.Entries[r.PoX.Identifier()]
+			if !ok || len(entry.History) == 0 {
+				continue
+			}
+			last := entry.History[len(entry.History)-1]
+			before := &report.Results[i].Before
+			before.Status = last.Status
+			before.Binding = last.Binding
+			before.MaintenanceStatus = last.MaintenanceStatus
+			before.MaintenanceEndDate = last.MaintenanceEndDate
+		}
+	}
+}
+
+// DisplayHistory displays the timeline of the PoS/PoL
+func (e *Entry) DisplayHistory() {
+	fmt.Printf("%s %s, first seen %s, last seen %s\n",
+		e.PoX.Type(),
+		e.PoX,
+		e.FirstSeen.Local().Format(timeFormat),
+		e.LastSeen.Local().Format(timeFormat),
+	)
+	if len(e.Sources) > 0 {
+		fmt.Printf("Read from %s\n", strings.Join(e.Sources, ", "))
+	}
+	fmt.Println()
+
+	for i, rec := range e.History {
+		if i == 0 {
+			fmt.Printf("- %s %s\n", aurora.Gray(12, rec.Time.Local().Format(timeFormat)), rec)
+			continue
+		}
+		fmt.Printf("- %s %s\n", aurora.Gray(12, rec.Time.Local().Format(timeFormat)), strings.Join(rec.changes(e.History[i-1]), ", "))
+	}
+}
+
+// At returns the PoS/PoL of the inventory as they were at t, sorted by
+// identifier. PoS/PoL without any record at or before t, their state at t
+// being unknown, are left out.
+func (inv *Inventory) At(t time.Time) pox.PoXList {
+	res := make(pox.PoXList, 0)
+	for _, p := range inv.PoXList() {
+		entry := inv.Get(p.Identifier())
+		for i := len(entry.History) - 1; i >= 0; i-- {
+			if !entry.History[i].Time.After(t) {
+				entry.History[i].apply(p)
+				res = append(res, p)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+const timeFormat = "2006-01-02 15:04:05"
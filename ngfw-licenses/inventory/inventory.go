@@ -0,0 +1,229 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+//=================================================================
+// Inventory
+
+// Entry is what the inventory knows about a PoS/PoL
+type Entry struct {
+	PoX       *pox.PoX  `json:"pox"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Sources are the files, URLs... the PoS/PoL has been read from
+	Sources []string `json:"sources,omitempty"`
+	// History records each change of the PoS/PoL, oldest first
+	History []Record `json:"history,omitempty"`
+}
+
+// Inventory records every PoS/PoL the tool has seen, in a single JSON file
+type Inventory struct {
+	path string
+	mu   sync.Mutex
+
+	Entries map[string]*Entry `json:"entries"`
+	// Merged are the PoS/PoL recorded under several identifiers differing by
+	// their case only, whose entries Open merged
+	Merged []string `json:"-"`
+}
+
+// Open reads the inventory stored at path, a missing file is an empty inventory
+func Open(path string) (*Inventory, error) {
+	inv := &Inventory{path: path, Entries: make(map[string]*Entry)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read inventory: %w", err)
+	}
+
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("unable to read inventory %s: %w", path, err)
+	}
+	// PoS/PoL used to be recorded as they were typed, they are lower-cased now
+	ids := make([]string, 0, len(inv.Entries))
+	for id := range inv.Entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	entries := make(map[string]*Entry, len(inv.Entries))
+	for _, id := range ids {
+		lower := strings.ToLower(id)
+		if entry, ok := entries[lower]; ok {
+			entry.merge(inv.Entries[id])
+			inv.Merged = append(inv.Merged, lower)
+			continue
+		}
+		entries[lower] = inv.Entries[id]
+	}
+	inv.Entries = entries
+
+	return inv, nil
+}
+
+// merge adds to e what other knows: its sources and history, its PoX when
+// seen last
+func (e *Entry) merge(other *Entry) {
+	if other.LastSeen.After(e.LastSeen) {
+		e.PoX, e.LastSeen = other.PoX, other.LastSeen
+	}
+	if other.FirstSeen.Before(e.FirstSeen) {
+		e.FirstSeen = other.FirstSeen
+	}
+	for _, source := range other.Sources {
+		if !contains(e.Sources, source) {
+			e.Sources = append(e.Sources, source)
+		}
+	}
+
+	history := append(e.History, other.History...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Time.Before(history[j].Time) })
+	e.History = nil
+	for _, rec := range history {
+		e.add(rec)
+	}
+}
+
+// Save writes the inventory back to its file. The file is replaced at once so
+// an interrupted save never leaves a truncated inventory.
+func (inv *Inventory) Save() error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(inv.path); dir != "." {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return fmt.Errorf("unable to save inventory: %w", err)
+		}
+	}
+	tmp := inv.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("unable to save inventory: %w", err)
+	}
+	if err := os.Rename(tmp, inv.path); err != nil {
+		return fmt.Errorf("unable to save inventory: %w", err)
+	}
+
+	return nil
+}
+
+// Update records the PoS/PoL of poxList as seen at now, and their changes in
+// the history. The fields of a PoS/PoL whose status could not be loaded from
+// the portal are neither overwritten nor recorded.
+func (inv *Inventory) Update(poxList pox.PoXList, now time.Time) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for _, p := range poxList {
+		entry, ok := inv.Entries[p.Identifier()]
+		if !ok {
+			entry = &Entry{FirstSeen: now}
+			inv.Entries[p.Identifier()] = entry
+		}
+		entry.LastSeen = now
+		if p.Source != "" && !contains(entry.Sources, p.Source) {
+			entry.Sources = append(entry.Sources, p.Source)
+		}
+
+		if entry.PoX == nil || loaded(p) {
+			latest := *p
+			if latest.Source == "" && entry.PoX != nil {
+				latest.Source = entry.PoX.Source
+			}
+			if latest.Metadata == nil && entry.PoX != nil {
+				latest.Metadata = entry.PoX.Metadata
+			}
+			entry.PoX = &latest
+		}
+		if loaded(p) {
+			entry.record(now)
+		}
+	}
+}
+
+// Get returns the entry of a PoS/PoL, or nil
+func (inv *Inventory) Get(identifier string) *Entry {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	return inv.Entries[strings.ToLower(identifier)]
+}
+
+// PoXList returns a copy of every PoS/PoL of the inventory, sorted by identifier
+func (inv *Inventory) PoXList() pox.PoXList {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	res := make(pox.PoXList, 0, len(inv.Entries))
+	for _, entry := range inv.Entries {
+		p := *entry.PoX
+		res = append(res, &p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Identifier() < res[j].Identifier() })
+
+	return res
+}
+
+// Fill sets the PoS/PoL of poxList to their latest state in the inventory,
+// keeping where they have been read from. It returns the PoS/PoL missing from
+// the inventory.
+func (inv *Inventory) Fill(poxList pox.PoXList) pox.PoXList {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	missing := make(pox.PoXList, 0)
+	for _, p := range poxList {
+		entry, ok := inv.Entries[p.Identifier()]
+		if !ok {
+			missing = append(missing, p)
+			continue
+		}
+		latest := *entry.PoX
+		if p.Source != "" {
+			latest.Source, latest.Line = p.Source, p.Line
+		}
+		if p.Metadata != nil {
+			latest.Metadata = p.Metadata
+		}
+		*p = latest
+	}
+	return missing
+}
+
+// loaded tells if the PoX fields come from the portal
+func loaded(p *pox.PoX) bool {
+	return p.Error == "" && known(p.Status)
+}
+
+// known tells if status has been loaded from the portal
+func known(status statutes.LicenseStatus) bool {
+	return status != "" && status != statutes.Unknown && status != statutes.Unreachable
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package inventory
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/notify"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+const (
+	testPoS = "0123456789-abcdef0123"
+	testPoL = "01234-56789-abcde-f0123"
+)
+
+func newPoX(t *testing.T, new func(string) (*pox.PoX, error), id string, status statutes.LicenseStatus, source string) *pox.PoX {
+	t.Helper()
+	p, err := new(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Status = status
+	p.Source = source
+	return p
+}
+
+func TestInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.json")
+
+	inv, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(inv.Entries) != 0 {
+		t.Fatalf("%d entries in a new inventory", len(inv.Entries))
+	}
+
+	first := time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC)
+	pos := newPoX(t, pox.NewPoS, testPoS, statutes.Purchased, "purchase.html")
+	pos.SerialNumber = "N0C012345678"
+	inv.Update(pox.PoXList{pos, newPoX(t, pox.NewPoL, testPoL, statutes.Registered, "")}, first)
+	if err := inv.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// the PoS is seen again, but the portal was unreachable
+	second := first.Add(24 * time.Hour)
+	unreachable := newPoX(t, pox.NewPoS, testPoS, statutes.Unreachable, "engines.txt")
+	unreachable.Error = "unreachable"
+	inv, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	inv.Update(pox.PoXList{unreachable}, second)
+	if err := inv.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	inv, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	entry := inv.Get(testPoS)
+	if entry == nil {
+		t.Fatalf("Get(%q) = nil", testPoS)
+	}
+	if !entry.FirstSeen.Equal(first) || !entry.LastSeen.Equal(second) {
+		t.Errorf("FirstSeen, LastSeen = %v, %v, want %v, %v", entry.FirstSeen, entry.LastSeen, first, second)
+	}
+	if len(entry.Sources) != 2 || entry.Sources[0] != "purchase.html" || entry.Sources[1] != "engines.txt" {
+		t.Errorf("Sources = %v", entry.Sources)
+	}
+	if entry.PoX.Status != statutes.Purchased || entry.PoX.SerialNumber != "N0C012345678" {
+		t.Errorf("PoX = %+v, want the fields loaded on first run", entry.PoX)
+	}
+
+	poxList := inv.PoXList()
+	if len(poxList) != 2 || poxList[0].Identifier() != testPoL || poxList[1].Identifier() != testPoS {
+		t.Fatalf("PoXList() = %v", poxList)
+	}
+	if poxList[0].Type() != pox.PoL || poxList[1].Type() != pox.PoS {
+		t.Errorf("types = %v, %v", poxList[0].Type(), poxList[1].Type())
+	}
+}
+
+func TestOpen_UpperCase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	upper := strings.ToUpper(testPoS)
+	ioutil.WriteFile(path, []byte(`{"entries":{"`+upper+`":{"pox":{"pos":"`+upper+`","licence_status":"REGISTERED"}}}}`), 0644)
+
+	// PoS/PoL recorded upper-cased are found as read from files
+	inv, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if entry := inv.Get(testPoS); entry == nil || entry.PoX.Identifier() != testPoS {
+		t.Fatalf("Get(%s) = %+v", testPoS, entry)
+	}
+	inv.Update(pox.PoXList{newPoX(t, pox.NewPoS, upper, statutes.Registered, "")}, time.Now())
+	if len(inv.Entries) != 1 {
+		t.Errorf("%d entries, want 1", len(inv.Entries))
+	}
+}
+
+func TestOpen_CaseCollision(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	upper := strings.ToUpper(testPoS)
+	ioutil.WriteFile(path, []byte(`{"entries":{
+"`+upper+`":{"pox":{"pos":"`+upper+`","licence_status":"REGISTERED"},"first_seen":"2021-04-12T09:00:00Z","last_seen":"2021-05-12T09:00:00Z","sources":["a.txt"],
+	"history":[{"time":"2021-04-12T09:00:00Z","licence_status":"PURCHASED"},{"time":"2021-05-12T09:00:00Z","licence_status":"REGISTERED"}]},
+"`+testPoS+`":{"pox":{"pos":"`+testPoS+`","licence_status":"PURCHASED"},"first_seen":"2021-03-12T09:00:00Z","last_seen":"2021-04-12T09:00:00Z","sources":["a.txt","b.txt"],
+	"history":[{"time":"2021-03-12T09:00:00Z","licence_status":"PURCHASED"},{"time":"2021-04-12T09:00:00Z","licence_status":"PURCHASED"}]}}}`), 0644)
+
+	// both entries are merged, and reported
+	inv, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(inv.Entries) != 1 || len(inv.Merged) != 1 || inv.Merged[0] != testPoS {
+		t.Fatalf("Open() = %d entries, merged %v", len(inv.Entries), inv.Merged)
+	}
+	entry := inv.Get(testPoS)
+	if entry.PoX.Status != statutes.Registered || entry.FirstSeen.Month() != time.March || entry.LastSeen.Month() != time.May {
+		t.Errorf("merged entry = %+v", entry)
+	}
+	if len(entry.Sources) != 2 {
+		t.Errorf("Sources = %v, want [a.txt b.txt]", entry.Sources)
+	}
+	if len(entry.History) != 2 || entry.History[0].Time.Month() != time.March || entry.History[1].Status != statutes.Registered {
+		t.Errorf("History = %v", entry.History)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	f, err := ioutil.TempFile("", "inventory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not json")
+	f.Close()
+
+	if _, err := Open(f.Name()); err == nil {
+		t.Errorf("Open() error = nil, want an error")
+	}
+}
+
+func TestInventory_History(t *testing.T) {
+	inv := &Inventory{Entries: make(map[string]*Entry)}
+	start := time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		status  statutes.LicenseStatus
+		binding string
+		err     string
+	}{
+		{statutes.Purchased, "", ""},
+		{statutes.Purchased, "", ""},
+		{statutes.Registered, "0a1b2c3d4e-5f6a7b8c9d", ""},
+		{statutes.Unreachable, "", "unreachable"},
+		{statutes.Registered, "0a1b2c3d4e-5f6a7b8c9d", ""},
+		{statutes.Registered, "192.168.1.1", ""},
+	}
+	for i, step := range steps {
+		p := newPoX(t, pox.NewPoS, testPoS, step.status, "")
+		p.Binding = step.binding
+		p.Error = step.err
+		inv.Update(pox.PoXList{p}, start.Add(time.Duration(i)*time.Hour))
+	}
+
+	history := inv.Get(testPoS).History
+	want := []struct {
+		hour    int
+		status  statutes.LicenseStatus
+		binding string
+	}{
+		{0, statutes.Purchased, ""},
+		{2, statutes.Registered, "0a1b2c3d4e-5f6a7b8c9d"},
+		{5, statutes.Registered, "192.168.1.1"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("%d records, want %d: %+v", len(history), len(want), history)
+	}
+	for i, w := range want {
+		rec := history[i]
+		if !rec.Time.Equal(start.Add(time.Duration(w.hour)*time.Hour)) || rec.Status != w.status || rec.Binding != w.binding {
+			t.Errorf("record %d = %+v, want %+v", i, rec, w)
+		}
+	}
+}
+
+func TestInventory_Record(t *testing.T) {
+	inv := &Inventory{Entries: make(map[string]*Entry)}
+	start := time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC)
+
+	// a register run on a PoS never seen: loaded PURCHASED, then registered
+	p := newPoX(t, pox.NewPoS, testPoS, statutes.Registered, "")
+	p.Binding = testPoS
+	failed := newPoX(t, pox.NewPoL, testPoL, statutes.Purchased, "")
+	refresh := &pox.Report{Action: pox.ActionRefresh, Start: start, Duration: time.Second, Results: []pox.Result{
+		{PoX: p, Before: pox.State{Status: statutes.Unknown}, After: pox.State{Status: statutes.Purchased}},
+		{PoX: failed, Before: pox.State{Status: statutes.Unknown}, After: pox.State{Status: statutes.Purchased}},
+	}}
+	register := &pox.Report{Action: pox.ActionRegister, Start: start.Add(time.Minute), Duration: time.Minute, Results: []pox.Result{
+		{PoX: p, Before: pox.State{Status: statutes.Purchased}, After: pox.State{Status: statutes.Registered, Binding: testPoS}},
+		{PoX: failed, Before: pox.State{Status: statutes.Purchased}, After: pox.State{Status: statutes.RegistrationError}, Err: errors.New("timeout")},
+	}}
+	inv.Record(refresh, register)
+	inv.Update(pox.PoXList{p, failed}, start.Add(time.Hour))
+
+	history := inv.Get(testPoS).History
+	want := []struct {
+		time   time.Time
+		status statutes.LicenseStatus
+	}{
+		{start.Add(time.Second), statutes.Purchased},
+		{start.Add(2 * time.Minute), statutes.Registered},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("History = %+v, want %d records", history, len(want))
+	}
+	for i, w := range want {
+		if !history[i].Time.Equal(w.time) || history[i].Status != w.status {
+			t.Errorf("History[%d] = %v %s, want %v %s", i, history[i].Time, history[i].Status, w.time, w.status)
+		}
+	}
+
+	// the state after a failed operation is not recorded
+	if history := inv.Get(testPoL).History; len(history) != 1 || history[0].Status != statutes.Purchased {
+		t.Errorf("PoL History = %+v, want PURCHASED only", history)
+	}
+}
+
+func TestInventory_Seed(t *testing.T) {
+	inv := &Inventory{Entries: make(map[string]*Entry)}
+	start := time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC)
+	inv.Update(pox.PoXList{newPoX(t, pox.NewPoS, testPoS, statutes.Purchased, "")}, start)
+
+	// a plain verify: the PoS was never loaded before in this run
+	p := newPoX(t, pox.NewPoS, testPoS, statutes.Registered, "")
+	unknown := newPoX(t, pox.NewPoL, testPoL, statutes.Registered, "")
+	verify := &pox.Report{Action: pox.ActionRefresh, Start: start.Add(24 * time.Hour), Results: []pox.Result{
+		{PoX: p, Before: pox.State{Status: statutes.Unknown}, After: pox.State{Status: statutes.Registered, Binding: "192.168.1.1"}},
+		{PoX: unknown, Before: pox.State{Status: statutes.Unknown}, After: pox.State{Status: statutes.Registered}},
+	}}
+	inv.Seed(verify)
+
+	if got := verify.Results[0].Before.Status; got != statutes.Purchased {
+		t.Errorf("Before.Status = %s, want %s", got, statutes.Purchased)
+	}
+	if got := verify.Results[1].Before.Status; got != statutes.Unknown {
+		t.Errorf("Before.Status of a PoL not in the inventory = %s, want %s", got, statutes.Unknown)
+	}
+	events := notify.Events(verify)
+	if len(events) != 1 || events[0].Type != notify.StatusChanged || events[0].Old != string(statutes.Purchased) {
+		t.Errorf("Events() = %+v, want a single %s from %s", events, notify.StatusChanged, statutes.Purchased)
+	}
+}
+
+func TestInventory_Fill(t *testing.T) {
+	inv := &Inventory{Entries: make(map[string]*Entry)}
+	registered := newPoX(t, pox.NewPoS, testPoS, statutes.Registered, "purchase.html")
+	registered.MaintenanceEndDate = "2022-04-12"
+	inv.Update(pox.PoXList{registered}, time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC))
+
+	// PoS/PoL read from command-line, not loaded from the portal
+	poxList := pox.PoXList{newPoX(t, pox.NewPoS, testPoS, statutes.Unknown, "engines.txt"), newPoX(t, pox.NewPoL, testPoL, statutes.Unknown, "")}
+	missing := inv.Fill(poxList)
+
+	if len(missing) != 1 || missing[0].Identifier() != testPoL {
+		t.Errorf("Fill() = %v, want %s missing", missing, testPoL)
+	}
+	if p := poxList[0]; p.Status != statutes.Registered || p.MaintenanceEndDate != "2022-04-12" || p.Source != "engines.txt" {
+		t.Errorf("Fill() PoS = %+v, want the inventory state read from engines.txt", p)
+	}
+	if p := poxList[1]; p.Status != statutes.Unknown {
+		t.Errorf("Fill() PoL Status = %v, want %v", p.Status, statutes.Unknown)
+	}
+}
+
+func TestInventory_At(t *testing.T) {
+	inv := &Inventory{Entries: make(map[string]*Entry)}
+	start := time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC)
+
+	inv.Update(pox.PoXList{newPoX(t, pox.NewPoS, testPoS, statutes.Purchased, "")}, start)
+	registered := newPoX(t, pox.NewPoS, testPoS, statutes.Registered, "")
+	registered.Company = "My Corp"
+	inv.Update(pox.PoXList{registered, newPoX(t, pox.NewPoL, testPoL, statutes.Registered, "")}, start.Add(48*time.Hour))
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		count  int
+		status statutes.LicenseStatus
+	}{
+		{"before", start.Add(-time.Hour), 0, ""},
+		{"first run", start.Add(time.Hour), 1, statutes.Purchased},
+		{"second run", start.Add(48 * time.Hour), 2, statutes.Registered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poxList := inv.At(tt.at)
+			if len(poxList) != tt.count {
+				t.Fatalf("%d PoS/PoL, want %d", len(poxList), tt.count)
+			}
+			for _, p := range poxList {
+				if p.Identifier() == testPoS && p.Status != tt.status {
+					t.Errorf("Status = %v, want %v", p.Status, tt.status)
+				}
+			}
+		})
+	}
+
+	if got := inv.Get(testPoS).PoX.Status; got != statutes.Registered {
+		t.Errorf("At() changed the inventory, Status = %v", got)
+	}
+
+	// an inventory written before the history was tracked: the PoS was seen
+	// before its first record, its state back then is unknown
+	inv = &Inventory{Entries: make(map[string]*Entry)}
+	inv.Update(pox.PoXList{newPoX(t, pox.NewPoS, testPoS, statutes.Purchased, "")}, start)
+	inv.Get(testPoS).History = nil
+	inv.Update(pox.PoXList{registered}, start.Add(48*time.Hour))
+	if poxList := inv.At(start.Add(time.Hour)); len(poxList) != 0 {
+		t.Errorf("At() before the first record = %v, want no PoS/PoL", poxList)
+	}
+	if poxList := inv.At(start.Add(48 * time.Hour)); len(poxList) != 1 || poxList[0].Status != statutes.Registered {
+		t.Errorf("At() = %v, want the registered PoS", poxList)
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.json")
+
+	if pox.Logger == nil {
+		pox.Logger = config.GetNewLogger("POX   ")
+	}
+	previous := config.Cfg
+	t.Cleanup(func() { config.Cfg = previous })
+	config.Cfg = config.Config{Silent: true, InventoryFile: path}
+
+	inv, _ := Open(path)
+	pos := newPoX(t, pox.NewPoS, testPoS, statutes.Registered, "purchase.html")
+	pos.Line = 12
+	inv.Update(pox.PoXList{pos, newPoX(t, pox.NewPoL, testPoL, statutes.Registered, "")}, time.Now())
+	if err := inv.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	for _, arg := range []string{SourcePrefix, SourcePrefix + path} {
+		poxList, err := pox.ReadPoXFormArgs([]string{arg}, false, false)
+		if err != nil {
+			t.Fatalf("ReadPoXFormArgs(%q) error = %v", arg, err)
+		}
+		if len(poxList) != 2 {
+			t.Fatalf("ReadPoXFormArgs(%q) = %v", arg, poxList)
+		}
+		// PoS/PoL keep the location they have first been read from
+		if l := poxList.GetAllPoS()[0].Location(); l != "purchase.html:12" {
+			t.Errorf("PoS Location() = %q, want purchase.html:12", l)
+		}
+		if l := poxList.GetAllPoL()[0].Location(); l != path {
+			t.Errorf("PoL Location() = %q, want %q", l, path)
+		}
+	}
+
+	if _, err := pox.ReadPoXFormArgs([]string{SourcePrefix + filepath.Join(dir, "missing.json")}, false, false); err == nil {
+		t.Errorf("ReadPoXFormArgs() error = nil, want an error")
+	}
+}
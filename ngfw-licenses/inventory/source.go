@@ -0,0 +1,66 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+)
+
+//=================================================================
+// Source
+
+// SourcePrefix introduces the inventories given on command-line: "inventory:"
+// reads the inventory_file, "inventory:<file>" reads another inventory
+const SourcePrefix = "inventory:"
+
+func init() {
+	pox.RegisterSource("inventory", openSource)
+}
+
+// source yields the PoS/PoL of an inventory, with the source and the line
+// they have first been read from
+type source struct {
+	path string
+}
+
+func openSource(arg string) ([]pox.Source, error) {
+	if !strings.HasPrefix(arg, SourcePrefix) {
+		return nil, nil
+	}
+	path := strings.TrimPrefix(arg, SourcePrefix)
+	if path == "" {
+		path = config.Cfg.InventoryFile
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%s requires an inventory_file", arg)
+	}
+	return []pox.Source{source{path}}, nil
+}
+
+func (s source) Name() string { return s.path }
+
+func (s source) Items() ([]pox.Item, error) {
+	if _, err := os.Stat(s.path); err != nil {
+		return nil, fmt.Errorf("unable to read inventory: %w", err)
+	}
+	inv, err := Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	poxList := inv.PoXList()
+	res := make([]pox.Item, 0, len(poxList))
+	for _, p := range poxList {
+		res = append(res, pox.Item{
+			ID:       p.Identifier(),
+			Type:     p.Type(),
+			Source:   p.Source,
+			Line:     p.Line,
+			Metadata: p.Metadata,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,296 @@
+package license_file
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// License file
+
+const (
+	ManifestFile   = "META-INF/MANIFEST.MF"
+	PropertiesFile = "license.properties"
+)
+
+var (
+	ErrNotLicenseFile    = errors.New("not a license file")
+	ErrMissingProperties = errors.New(PropertiesFile + " not found")
+	ErrMismatch          = errors.New("license file does not match")
+)
+
+// signatureExtensions are the signature block files of a signed jar, by
+// algorithm
+var signatureExtensions = map[string]string{".RSA": "RSA", ".DSA": "DSA", ".EC": "EC"}
+
+// LicenseFile is the metadata of a .jar license file, as generated by the
+// license portal. Properties and Manifest hold every entry read, the known
+// ones being copied in the other fields.
+//
+// The layout of license files is not documented, no real one has been
+// available to build the parser: license.properties and its keys are a best
+// guess. A jar without it is still read, LicenseID, Product and Binding being
+// left empty, and cannot be checked.
+type LicenseFile struct {
+	Name           string            `json:"name,omitempty"`
+	Entries        []string          `json:"entries"`
+	LicenseID      string            `json:"license_id,omitempty"`
+	Product        string            `json:"product,omitempty"`
+	Binding        string            `json:"binding,omitempty"`
+	Platform       string            `json:"platform,omitempty"`
+	MaintenanceEnd string            `json:"maintenance_end,omitempty"`
+	Features       []string          `json:"features,omitempty"`
+	Signature      *Signature        `json:"signature,omitempty"`
+	Manifest       map[string]string `json:"manifest,omitempty"`
+	Properties     map[string]string `json:"properties,omitempty"`
+}
+
+// Signature is the signature block of a signed jar
+type Signature struct {
+	File      string `json:"file"`
+	Algorithm string `json:"algorithm"`
+	Size      int    `json:"size"`
+	// Signer is the name of the .SF signature file, Digests its digests of
+	// the manifest
+	Signer  string            `json:"signer,omitempty"`
+	Digests map[string]string `json:"digests,omitempty"`
+}
+
+// Open reads a license file
+func Open(filename string) (*LicenseFile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lf, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	lf.Name = path.Base(filename)
+	return lf, nil
+}
+
+// Parse reads the content of a license file, which must be a jar. The
+// properties are read when the jar holds a license.properties entry.
+func Parse(data []byte) (*LicenseFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotLicenseFile, err)
+	}
+
+	lf := &LicenseFile{Entries: make([]string, 0, len(zr.File))}
+	signatures := make(map[string]map[string]string)
+	for _, f := range zr.File {
+		lf.Entries = append(lf.Entries, f.Name)
+		upper := strings.ToUpper(f.Name)
+		switch {
+		case f.Name == PropertiesFile:
+			err = readEntry(f, func(r io.Reader) (err error) {
+				lf.Properties, err = readProperties(r)
+				return err
+			})
+		case upper == ManifestFile:
+			err = readEntry(f, func(r io.Reader) (err error) {
+				lf.Manifest, err = readManifest(r)
+				return err
+			})
+		case strings.HasPrefix(upper, "META-INF/") && path.Ext(upper) == ".SF":
+			err = readEntry(f, func(r io.Reader) error {
+				attributes, err := readManifest(r)
+				signatures[strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))] = attributes
+				return err
+			})
+		case strings.HasPrefix(upper, "META-INF/") && signatureExtensions[path.Ext(upper)] != "":
+			lf.Signature = &Signature{
+				File:      f.Name,
+				Algorithm: signatureExtensions[path.Ext(upper)],
+				Size:      int(f.UncompressedSize64),
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrNotLicenseFile, f.Name, err)
+		}
+	}
+	if lf.Signature != nil {
+		signer := strings.TrimSuffix(path.Base(lf.Signature.File), path.Ext(lf.Signature.File))
+		if attributes, ok := signatures[signer]; ok {
+			lf.Signature.Signer = signer + ".SF"
+			lf.Signature.Digests = make(map[string]string)
+			for k, v := range attributes {
+				if strings.HasSuffix(k, "-Digest-Manifest") {
+					lf.Signature.Digests[strings.TrimSuffix(k, "-Digest-Manifest")] = v
+				}
+			}
+		}
+	}
+
+	lf.LicenseID = lf.Properties["license.id"]
+	lf.Product = lf.Properties["product"]
+	lf.Binding = lf.Properties["binding"]
+	lf.Platform = lf.Properties["platform"]
+	lf.MaintenanceEnd = lf.Properties["maintenance.end"]
+	lf.Features = features(lf.Properties)
+
+	return lf, nil
+}
+
+func readEntry(f *zip.File, fct func(io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return fct(rc)
+}
+
+// features returns the features listed by the features property, and the ones
+// given as feature.<name> properties
+func features(properties map[string]string) (res []string) {
+	for _, f := range strings.Split(properties["features"], ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			res = append(res, f)
+		}
+	}
+	for k, v := range properties {
+		if strings.HasPrefix(k, "feature.") && v != "" && !strings.EqualFold(v, "false") {
+			res = append(res, strings.TrimPrefix(k, "feature."))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// readProperties reads a Java properties file: key=value or key: value lines,
+// # and ! comments, and \ line continuations
+func readProperties(r io.Reader) (map[string]string, error) {
+	res := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	line := ""
+	for scanner.Scan() {
+		text := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" && (text == "" || text[0] == '#' || text[0] == '!') {
+			continue
+		}
+		if strings.HasSuffix(text, `\`) {
+			line += strings.TrimSuffix(text, `\`)
+			continue
+		}
+		line += text
+
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			res[strings.TrimSpace(line)] = ""
+		} else {
+			res[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+		line = ""
+	}
+	return res, scanner.Err()
+}
+
+// readManifest reads the main section of a jar manifest: "Name: value" lines,
+// continued by lines starting with a space
+func readManifest(r io.Reader) (map[string]string, error) {
+	res := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	last := ""
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			// the main section ends with the first blank line
+			break
+		}
+		if text[0] == ' ' && last != "" {
+			res[last] += text[1:]
+			continue
+		}
+		if kv := strings.SplitN(text, ":", 2); len(kv) == 2 {
+			last = strings.TrimSpace(kv[0])
+			res[last] = strings.TrimSpace(kv[1])
+		}
+	}
+	return res, scanner.Err()
+}
+
+//=================================================================
+// Check
+
+// Expected is what a license file should contain, empty fields are not checked
+type Expected struct {
+	LicenseID string
+	Product   string
+	Binding   string
+}
+
+// Check returns an ErrMismatch error listing the metadata which differ from
+// expected, or ErrMissingProperties when the license file has no properties
+// to check
+func (lf *LicenseFile) Check(expected Expected) error {
+	if lf.Properties == nil {
+		return ErrMissingProperties
+	}
+
+	mismatches := make([]string, 0)
+	check := func(name, want, got string) {
+		if want != "" && !strings.EqualFold(strings.TrimSpace(want), got) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q instead of %q", name, got, want))
+		}
+	}
+	check("license.id", expected.LicenseID, lf.LicenseID)
+	check("product", expected.Product, lf.Product)
+	check("binding", expected.Binding, lf.Binding)
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%w: %s", ErrMismatch, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
+
+//=================================================================
+// Display
+
+func (lf *LicenseFile) Display() {
+	if lf.Name != "" {
+		fmt.Printf("\n%s\n", aurora.Bold(lf.Name))
+	}
+	if lf.Properties == nil {
+		fmt.Printf("  Properties:      %s\n", aurora.Yellow("unknown, no "+PropertiesFile))
+		fmt.Printf("  Entries:         %s\n", strings.Join(lf.Entries, ", "))
+	} else {
+		fmt.Printf("  License ID:      %s\n", aurora.Green(lf.LicenseID))
+		fmt.Printf("  Product:         %s\n", lf.Product)
+		fmt.Printf("  Binding:         %s\n", aurora.Cyan(lf.Binding))
+	}
+	if lf.Platform != "" {
+		fmt.Printf("  Platform:        %s\n", lf.Platform)
+	}
+	if lf.MaintenanceEnd != "" {
+		fmt.Printf("  Support end:     %s\n", lf.MaintenanceEnd)
+	}
+	if len(lf.Features) > 0 {
+		fmt.Printf("  Features:        %s\n", strings.Join(lf.Features, ", "))
+	}
+	if lf.Signature == nil {
+		fmt.Printf("  Signature:       %s\n", aurora.Yellow("none"))
+		return
+	}
+	fmt.Printf("  Signature:       %s %s, %d bytes\n", lf.Signature.Algorithm, lf.Signature.File, lf.Signature.Size)
+	algorithms := make([]string, 0, len(lf.Signature.Digests))
+	for algorithm := range lf.Signature.Digests {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	for _, algorithm := range algorithms {
+		fmt.Printf("  %-16s %s\n", algorithm+":", aurora.Gray(12, lf.Signature.Digests[algorithm]))
+	}
+}
@@ -0,0 +1,135 @@
+package license_file
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newJar returns a zip holding files
+func newJar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	data := newJar(t, map[string]string{
+		"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\nCreated-By: Forcepoint license\r\n  portal\r\n\r\nName: license.properties\r\nSHA-256-Digest: abc\r\n",
+		"META-INF/LICENSE.SF":  "Signature-Version: 1.0\r\nSHA-256-Digest-Manifest: 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=\r\n",
+		"META-INF/LICENSE.RSA": "0123456789",
+		"license.properties": "# generated\n" +
+			"license.id = 700001\n" +
+			"product=Forcepoint NGFW 120W Appliance\n" +
+			"binding: 0123456789-abcdef0123\n" +
+			"platform=Appliance\n" +
+			"maintenance.end=2023-12-22\n" +
+			"features=VPN, \\\n    IPS\n" +
+			"feature.sandbox=true\n" +
+			"feature.urlfiltering=false\n",
+	})
+
+	lf, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if lf.LicenseID != "700001" || lf.Product != "Forcepoint NGFW 120W Appliance" || lf.Binding != "0123456789-abcdef0123" ||
+		lf.Platform != "Appliance" || lf.MaintenanceEnd != "2023-12-22" {
+		t.Errorf("Parse() = %+v", lf)
+	}
+	if want := []string{"IPS", "VPN", "sandbox"}; !reflect.DeepEqual(lf.Features, want) {
+		t.Errorf("Features = %v, want %v", lf.Features, want)
+	}
+	if got := lf.Manifest["Created-By"]; got != "Forcepoint license portal" {
+		t.Errorf("Manifest[Created-By] = %q", got)
+	}
+	if _, ok := lf.Manifest["SHA-256-Digest"]; ok {
+		t.Errorf("Manifest holds entries of sections other than the main one: %v", lf.Manifest)
+	}
+	want := &Signature{
+		File:      "META-INF/LICENSE.RSA",
+		Algorithm: "RSA",
+		Size:      10,
+		Signer:    "LICENSE.SF",
+		Digests:   map[string]string{"SHA-256": "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+	}
+	if !reflect.DeepEqual(lf.Signature, want) {
+		t.Errorf("Signature = %+v, want %+v", lf.Signature, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse([]byte("<html><body>Session expired</body></html>")); !errors.Is(err, ErrNotLicenseFile) {
+		t.Errorf("Parse(html) error = %v, want %v", err, ErrNotLicenseFile)
+	}
+	if _, err := Parse(nil); !errors.Is(err, ErrNotLicenseFile) {
+		t.Errorf("Parse(empty) error = %v, want %v", err, ErrNotLicenseFile)
+	}
+}
+
+func TestParseWithoutProperties(t *testing.T) {
+	// the layout of real license files is unknown: a jar without
+	// license.properties is read, but cannot be checked
+	lf, err := Parse(newJar(t, map[string]string{
+		"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\n",
+		"META-INF/LICENSE.RSA": "0123456789",
+		"license.xml":          "<license/>",
+	}))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(lf.Entries) != 3 || lf.Manifest["Manifest-Version"] != "1.0" || lf.Signature == nil || lf.Properties != nil || lf.LicenseID != "" {
+		t.Errorf("Parse() = %+v", lf)
+	}
+	if err := lf.Check(Expected{LicenseID: "700001"}); !errors.Is(err, ErrMissingProperties) {
+		t.Errorf("Check() error = %v, want %v", err, ErrMissingProperties)
+	}
+}
+
+func TestOpenCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "license-file-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "700001.jar")
+	ioutil.WriteFile(filename, newJar(t, map[string]string{
+		"license.properties": "license.id=700001\nproduct=NGFW\nbinding=10.0.0.1\n",
+	}), 0644)
+
+	lf, err := Open(filename)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if lf.Name != "700001.jar" || lf.Signature != nil {
+		t.Errorf("Open() = %+v", lf)
+	}
+
+	if err := lf.Check(Expected{LicenseID: "700001", Product: "ngfw", Binding: "10.0.0.1"}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := lf.Check(Expected{LicenseID: "700001"}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := lf.Check(Expected{LicenseID: "700002", Binding: "10.0.0.2"}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Check() error = %v, want %v", err, ErrMismatch)
+	}
+}
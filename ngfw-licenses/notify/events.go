@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+//=================================================================
+// Events
+
+type EventType string
+
+const (
+	StatusChanged  EventType = "status_changed"
+	BindingChanged EventType = "binding_changed"
+	SupportExpired EventType = "support_expired"
+)
+
+// Event is a change of a PoS/PoL seen by a bulk operation
+type Event struct {
+	Type        EventType   `json:"event"`
+	Time        time.Time   `json:"time"`
+	Action      pox.Action  `json:"action"`
+	PoX         string      `json:"pox"`
+	PoXType     pox.PoXType `json:"type"`
+	Company     string      `json:"company,omitempty"`
+	ProductName string      `json:"product_name,omitempty"`
+	Old         string      `json:"old"`
+	New         string      `json:"new"`
+	Error       string      `json:"error,omitempty"`
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case StatusChanged:
+		return fmt.Sprintf("%s %s status changed from %s to %s", e.PoXType, e.PoX, e.Old, e.New)
+	case BindingChanged:
+		return fmt.Sprintf("%s %s binding changed from %q to %q", e.PoXType, e.PoX, e.Old, e.New)
+	case SupportExpired:
+		return fmt.Sprintf("%s %s support expired on %s", e.PoXType, e.PoX, e.New)
+	}
+	return fmt.Sprintf("%s %s %s", e.PoXType, e.PoX, e.Type)
+}
+
+// Events returns the changes recorded by reports. The first load of a PoS/PoL
+// is not a change, unless its state before was seeded from the inventory, nor
+// is the portal being unreachable, nor the binding set by its registration.
+func Events(reports ...*pox.Report) []Event {
+	res := make([]Event, 0)
+	for _, report := range reports {
+		if report == nil {
+			continue
+		}
+		for _, r := range report.Results {
+			if r.Skipped || !known(r.Before.Status) || !known(r.After.Status) {
+				continue
+			}
+
+			newEvent := func(_type EventType, from, to string) Event {
+				e := Event{
+					Type:        _type,
+					Time:        report.Start.Add(report.Duration),
+					Action:      r.Action,
+					PoX:         r.PoX.Identifier(),
+					PoXType:     r.PoX.Type(),
+					Company:     r.PoX.Company,
+					ProductName: r.PoX.ProductName,
+					Old:         from,
+					New:         to,
+				}
+				if r.Err != nil {
+					e.Error = r.Err.Error()
+				}
+				return e
+			}
+
+			if r.Before.Status != r.After.Status {
+				res = append(res, newEvent(StatusChanged, string(r.Before.Status), string(r.After.Status)))
+			}
+			// the binding set by the first registration is not a change
+			if r.Before.Binding != "" && r.Before.Binding != r.After.Binding {
+				res = append(res, newEvent(BindingChanged, r.Before.Binding, r.After.Binding))
+			}
+			if r.Before.MaintenanceStatus != statutes.Expired && r.After.MaintenanceStatus == statutes.Expired {
+				res = append(res, newEvent(SupportExpired, r.Before.MaintenanceEndDate, r.After.MaintenanceEndDate))
+			}
+		}
+	}
+
+	return res
+}
+
+// known tells if status comes from the portal
+func known(status statutes.LicenseStatus) bool {
+	return status != statutes.Unknown && status != statutes.Unreachable
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+const (
+	testPoS = "0123456789-abcdef0123"
+	testPoL = "01234-56789-abcde-f0123"
+)
+
+func mustNewPoX(t *testing.T, new func(string) (*pox.PoX, error), id string) *pox.PoX {
+	t.Helper()
+	p, err := new(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testReport(t *testing.T) *pox.Report {
+	pos, pol := mustNewPoX(t, pox.NewPoS, testPoS), mustNewPoX(t, pox.NewPoL, testPoL)
+	pos.Company = "My Corp"
+
+	return &pox.Report{
+		Action: pox.ActionRefresh,
+		Start:  time.Date(2021, 4, 12, 9, 0, 0, 0, time.UTC),
+		Results: []pox.Result{
+			// first load
+			{PoX: pos, Before: pox.State{Status: statutes.Unknown}, After: pox.State{Status: statutes.Purchased}},
+			// unreachable
+			{PoX: pos, Before: pox.State{Status: statutes.Purchased}, After: pox.State{Status: statutes.Unreachable}},
+			// registered, and its support expired
+			{PoX: pos,
+				Before: pox.State{Status: statutes.Purchased, MaintenanceStatus: statutes.Activated, MaintenanceEndDate: "2021-04-01"},
+				After:  pox.State{Status: statutes.Registered, MaintenanceStatus: statutes.Expired, MaintenanceEndDate: "2021-04-01"}},
+			// binding changed
+			{PoX: pol, Before: pox.State{Status: statutes.Registered, Binding: "a"}, After: pox.State{Status: statutes.Registered, Binding: "b"}},
+			// registration failed
+			{PoX: pol, Before: pox.State{Status: statutes.Purchased}, After: pox.State{Status: statutes.RegistrationError}, Err: errors.New("registration timeout")},
+			{PoX: pol, Before: pox.State{Status: statutes.Purchased}, After: pox.State{Status: statutes.Purchased}, Skipped: true},
+		},
+	}
+}
+
+func TestEvents(t *testing.T) {
+	events := Events(testReport(t), nil)
+
+	want := []struct {
+		_type    EventType
+		pox      string
+		old, new string
+	}{
+		{StatusChanged, testPoS, "PURCHASED", "REGISTERED"},
+		{SupportExpired, testPoS, "2021-04-01", "2021-04-01"},
+		{BindingChanged, testPoL, "a", "b"},
+		{StatusChanged, testPoL, "PURCHASED", "REGISTRATION_ERROR"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("%d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Type != w._type || e.PoX != w.pox || e.Old != w.old || e.New != w.new {
+			t.Errorf("event %d = %+v, want %+v", i, e, w)
+		}
+	}
+	if events[0].Company != "My Corp" || events[0].PoXType != pox.PoS {
+		t.Errorf("event 0 = %+v, want My Corp PoS", events[0])
+	}
+	if events[3].Error != "registration timeout" {
+		t.Errorf("Error = %q, want %q", events[3].Error, "registration timeout")
+	}
+
+	// a PoL registration binds it: its status changed, not its binding
+	registration := &pox.Report{Action: pox.ActionRegister, Results: []pox.Result{
+		{PoX: mustNewPoX(t, pox.NewPoL, testPoL), Before: pox.State{Status: statutes.Purchased}, After: pox.State{Status: statutes.Registered, Binding: "192.168.1.1"}},
+	}}
+	if events := Events(registration); len(events) != 1 || events[0].Type != StatusChanged {
+		t.Errorf("Events() = %+v, want a single %s", events, StatusChanged)
+	}
+}
@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+)
+
+//=================================================================
+// Mailer
+
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+)
+
+var smtpTimeout = 30 * time.Second
+
+// Mailer sends emails through an SMTP server, to the recipients of each company
+type Mailer struct {
+	config.SMTP
+	// DefaultRecipient receives the emails of the companies without recipients
+	DefaultRecipient string
+}
+
+func NewMailer(cfg config.SMTP, defaultRecipient string) (*Mailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("smtp: missing host")
+	}
+	if cfg.From == "" {
+		return nil, fmt.Errorf("smtp: missing from address")
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSNone
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		return nil, fmt.Errorf("smtp: unknown tls mode %q", cfg.TLS)
+	}
+	if cfg.Port == 0 {
+		switch cfg.TLS {
+		case TLSStartTLS:
+			cfg.Port = 587
+		case TLSImplicit:
+			cfg.Port = 465
+		default:
+			cfg.Port = 25
+		}
+	}
+
+	return &Mailer{SMTP: cfg, DefaultRecipient: defaultRecipient}, nil
+}
+
+// recipients returns the recipients of company. Company names are compared
+// case-insensitively, config keys being lowercased.
+func (m *Mailer) recipients(company string) []string {
+	for name, recipients := range m.Recipients {
+		if strings.EqualFold(name, company) && len(recipients) > 0 {
+			return recipients
+		}
+	}
+	if m.DefaultRecipient != "" {
+		return []string{m.DefaultRecipient}
+	}
+	return nil
+}
+
+// Send sends a plain text email
+func (m *Mailer) Send(to []string, subject, body string) error {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	tlsConfig := &tls.Config{ServerName: m.Host}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if m.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if m.TLS == TLSStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+
+	if err := c.Mail(m.From); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp: %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err := w.Write(m.message(to, subject, body)); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+
+	return c.Quit()
+}
+
+func (m *Mailer) message(to []string, subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// sendByCompany sends one email per company, a failing company does not
+// prevent the others from being sent
+func (m *Mailer) sendByCompany(bodies map[string]*bytes.Buffer, subject func(company string) string) error {
+	companies := make([]string, 0, len(bodies))
+	for company := range bodies {
+		companies = append(companies, company)
+	}
+	sort.Strings(companies)
+
+	failed := make([]string, 0)
+	for _, company := range companies {
+		to := m.recipients(company)
+		if len(to) == 0 {
+			failed = append(failed, fmt.Sprintf("no recipient for company %q", company))
+			continue
+		}
+		if err := m.Send(to, subject(company), bodies[company].String()); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to send emails: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func companyName(company string) string {
+	if company == "" {
+		return "Unknown company"
+	}
+	return company
+}
+
+//=================================================================
+// Summaries
+
+// SendSummary emails to each company the PoS/PoL registered, downloaded, or
+// failing in the register and download reports
+func (m *Mailer) SendSummary(reports ...*pox.Report) error {
+	bodies := make(map[string]*bytes.Buffer)
+	write := func(company, line string) {
+		if bodies[company] == nil {
+			bodies[company] = &bytes.Buffer{}
+			fmt.Fprintf(bodies[company], "Forcepoint NGFW licenses of %s\n\n", companyName(company))
+		}
+		bodies[company].WriteString(line + "\n")
+	}
+
+	for _, report := range reports {
+		if report == nil || (report.Action != pox.ActionRegister && report.Action != pox.ActionDownload) {
+			continue
+		}
+		for _, r := range report.Results {
+			p := r.PoX
+			switch {
+			case r.Err != nil:
+				write(p.Company, fmt.Sprintf("- %s %s %s failed: %v", p.Type(), p.Identifier(), r.Action, r.Err))
+			case r.Changed && r.Action == pox.ActionRegister:
+				write(p.Company, fmt.Sprintf("- %s %s registered, %s, SN %s, license file %s", p.Type(), p.Identifier(), p.ProductName, p.SerialNumber, p.LicenseFile))
+			case r.Changed && r.Action == pox.ActionDownload:
+				write(p.Company, fmt.Sprintf("- %s %s license file %s downloaded", p.Type(), p.Identifier(), p.LicenseFile))
+			}
+		}
+	}
+
+	return m.sendByCompany(bodies, func(company string) string {
+		return "Forcepoint NGFW licenses registration: " + companyName(company)
+	})
+}
+
+// SendExpiryDigest emails to each company the PoS/PoL whose support ends soon,
+// then the ones whose support has recently ended
+func (m *Mailer) SendExpiryDigest(report *pox.ExpiryReport) error {
+	bodies := make(map[string]*bytes.Buffer)
+	for _, group := range append(append([]pox.ExpiryGroup(nil), report.Groups...), report.Expired...) {
+		body, ok := bodies[group.Company]
+		if !ok {
+			body = &bytes.Buffer{}
+			bodies[group.Company] = body
+			fmt.Fprintf(body, "Forcepoint NGFW licenses of %s whose support ends soon\n", companyName(group.Company))
+		}
+		fmt.Fprintf(body, "\n%s:\n", group.ProductName)
+		for _, e := range group.Expiries {
+			when := fmt.Sprintf("%d days left", e.DaysLeft)
+			if e.DaysLeft < 0 {
+				when = fmt.Sprintf("ended %d days ago", -e.DaysLeft)
+			}
+			fmt.Fprintf(body, "- %s %s, SN %s, support ends %s (%s)\n",
+				e.PoX.Type(), e.PoX.Identifier(), e.PoX.SerialNumber, e.PoX.MaintenanceEndDate, when)
+		}
+	}
+
+	return m.sendByCompany(bodies, func(company string) string {
+		return "Forcepoint NGFW licenses support expiry: " + companyName(company)
+	})
+}
@@ -0,0 +1,258 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+// mail is an email received by smtpServer
+type mail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal SMTP server, accepting PLAIN authentication
+type smtpServer struct {
+	net.Listener
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	mails []mail
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &smtpServer{Listener: l}
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			srv.wg.Add(1)
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		srv.wg.Wait()
+	})
+	return srv
+}
+
+func (srv *smtpServer) serve(conn net.Conn) {
+	defer srv.wg.Done()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+
+	var m mail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250-AUTH PLAIN")
+			reply("250 8BITMIME")
+		case "AUTH":
+			fields := strings.Fields(line)
+			auth, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			m.auth = string(auth)
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			m.from = line[strings.Index(line, "<")+1 : strings.Index(line, ">")]
+			reply("250 OK")
+		case "RCPT":
+			m.to = append(m.to, line[strings.Index(line, "<")+1:strings.Index(line, ">")])
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			m.data = data.String()
+			srv.mu.Lock()
+			srv.mails = append(srv.mails, m)
+			srv.mu.Unlock()
+			m = mail{}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (srv *smtpServer) received() []mail {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]mail(nil), srv.mails...)
+}
+
+func newTestMailer(t *testing.T, srv *smtpServer) *Mailer {
+	host, port, _ := net.SplitHostPort(srv.Addr().String())
+	p, _ := strconv.Atoi(port)
+	m, err := NewMailer(config.SMTP{
+		Host:     host,
+		Port:     p,
+		Username: "user",
+		Password: "secret",
+		From:     "licenses@example.com",
+		// config keys are lowercased
+		Recipients: map[string][]string{"my corp": {"it@mycorp.example.com", "cto@mycorp.example.com"}},
+	}, "default@example.com")
+	if err != nil {
+		t.Fatalf("NewMailer() error = %v", err)
+	}
+	return m
+}
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		cfg      config.SMTP
+		wantErr  bool
+		wantPort int
+	}{
+		{config.SMTP{Host: "smtp", From: "a@b"}, false, 25},
+		{config.SMTP{Host: "smtp", From: "a@b", TLS: TLSStartTLS}, false, 587},
+		{config.SMTP{Host: "smtp", From: "a@b", TLS: TLSImplicit}, false, 465},
+		{config.SMTP{Host: "smtp", From: "a@b", TLS: "ssl"}, true, 0},
+		{config.SMTP{From: "a@b"}, true, 0},
+		{config.SMTP{Host: "smtp"}, true, 0},
+	}
+	for _, tt := range tests {
+		m, err := NewMailer(tt.cfg, "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewMailer(%+v) error = %v, want error %v", tt.cfg, err, tt.wantErr)
+		}
+		if err == nil && m.Port != tt.wantPort {
+			t.Errorf("NewMailer(%+v) Port = %d, want %d", tt.cfg, m.Port, tt.wantPort)
+		}
+	}
+}
+
+func TestMailer_SendSummary(t *testing.T) {
+	srv := newSMTPServer(t)
+	m := newTestMailer(t, srv)
+
+	pos, other := mustNewPoX(t, pox.NewPoS, testPoS), mustNewPoX(t, pox.NewPoL, testPoL)
+	pos.Company, pos.SerialNumber, pos.LicenseFile = "My Corp", "N0C012345678", "700002.jar"
+	other.Company = "Other Corp"
+
+	err := m.SendSummary(
+		&pox.Report{Action: pox.ActionRefresh, Results: []pox.Result{{PoX: pos, Action: pox.ActionRefresh, Changed: true}}},
+		&pox.Report{Action: pox.ActionRegister, Results: []pox.Result{
+			{PoX: pos, Action: pox.ActionRegister, Changed: true, After: pox.State{Status: statutes.Registered}},
+			{PoX: other, Action: pox.ActionRegister},
+		}},
+		&pox.Report{Action: pox.ActionDownload, Results: []pox.Result{{PoX: pos, Action: pox.ActionDownload, Changed: true}}},
+	)
+	if err != nil {
+		t.Fatalf("SendSummary() error = %v", err)
+	}
+
+	mails := srv.received()
+	if len(mails) != 1 {
+		t.Fatalf("%d emails sent, want 1", len(mails))
+	}
+	got := mails[0]
+	if got.auth != "\x00user\x00secret" {
+		t.Errorf("auth = %q", got.auth)
+	}
+	if got.from != "licenses@example.com" || strings.Join(got.to, ",") != "it@mycorp.example.com,cto@mycorp.example.com" {
+		t.Errorf("from %s to %v", got.from, got.to)
+	}
+	for _, want := range []string{
+		"Subject: Forcepoint NGFW licenses registration: My Corp",
+		testPoS + " registered",
+		"N0C012345678",
+		"license file 700002.jar downloaded",
+	} {
+		if !strings.Contains(got.data, want) {
+			t.Errorf("email does not contain %q:\n%s", want, got.data)
+		}
+	}
+}
+
+func TestMailer_SendExpiryDigest(t *testing.T) {
+	srv := newSMTPServer(t)
+	m := newTestMailer(t, srv)
+
+	now := time.Now()
+	newExpiring := func(new func(string) (*pox.PoX, error), id, company string, days int) *pox.PoX {
+		p := mustNewPoX(t, new, id)
+		p.Company, p.ProductName = company, "NGFW 120W"
+		p.MaintenanceStatus, p.MaintenanceEndDate = statutes.Activated, now.AddDate(0, 0, days).Format("2006-01-02")
+		return p
+	}
+	report := pox.PoXList{
+		newExpiring(pox.NewPoS, testPoS, "MY CORP", 10),
+		newExpiring(pox.NewPoL, testPoL, "Other Corp", -3),
+	}.Expiring(now, []int{30}, 30)
+
+	if err := m.SendExpiryDigest(report); err != nil {
+		t.Fatalf("SendExpiryDigest() error = %v", err)
+	}
+
+	mails := srv.received()
+	if len(mails) != 2 {
+		t.Fatalf("%d emails sent, want 2", len(mails))
+	}
+	// companies are sorted, and matched case-insensitively
+	if len(mails[0].to) != 2 || !strings.Contains(mails[0].data, "10 days left") {
+		t.Errorf("MY CORP email to %v:\n%s", mails[0].to, mails[0].data)
+	}
+	if len(mails[1].to) != 1 || mails[1].to[0] != "default@example.com" || !strings.Contains(mails[1].data, "ended 3 days ago") {
+		t.Errorf("Other Corp email to %v:\n%s", mails[1].to, mails[1].data)
+	}
+}
+
+func TestMailer_noRecipient(t *testing.T) {
+	srv := newSMTPServer(t)
+	m := newTestMailer(t, srv)
+	m.DefaultRecipient = ""
+
+	pos := mustNewPoX(t, pox.NewPoS, testPoS)
+	pos.Company = "Unknown Corp"
+	err := m.SendSummary(&pox.Report{Action: pox.ActionRegister, Results: []pox.Result{{PoX: pos, Action: pox.ActionRegister, Changed: true}}})
+	if err == nil || !strings.Contains(err.Error(), "Unknown Corp") {
+		t.Errorf("SendSummary() error = %v, want no recipient for Unknown Corp", err)
+	}
+	if got := len(srv.received()); got != 0 {
+		t.Errorf("%d emails sent, want 0", got)
+	}
+}
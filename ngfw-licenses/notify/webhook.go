@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/go-resty/resty/v2"
+)
+
+//=================================================================
+// Webhooks
+
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+	FormatTeams = "teams"
+)
+
+var webhookTimeout = 10 * time.Second
+
+// Webhook posts events to a URL, as JSON events or as Slack or Teams messages
+type Webhook struct {
+	config.Webhook
+	client *resty.Client
+}
+
+func NewWebhook(hook config.Webhook) (*Webhook, error) {
+	if hook.URL == "" {
+		return nil, fmt.Errorf("webhook without url")
+	}
+	switch hook.Format {
+	case "":
+		hook.Format = FormatJSON
+	case FormatJSON, FormatSlack, FormatTeams:
+	default:
+		return nil, fmt.Errorf("webhook %s: unknown format %q", hook.URL, hook.Format)
+	}
+
+	return &Webhook{Webhook: hook, client: resty.New().SetTimeout(webhookTimeout)}, nil
+}
+
+// Notify posts the events the webhook subscribed to. JSON webhooks receive
+// one POST per event, Slack and Teams ones a single message.
+func (w *Webhook) Notify(ctx context.Context, events []Event) error {
+	events = w.filter(events)
+	if len(events) == 0 {
+		return nil
+	}
+
+	switch w.Format {
+	case FormatSlack:
+		return w.post(ctx, slackPayload(events))
+	case FormatTeams:
+		return w.post(ctx, teamsPayload(events))
+	}
+
+	for _, event := range events {
+		if err := w.post(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) filter(events []Event) []Event {
+	if len(w.Events) == 0 {
+		return events
+	}
+
+	res := make([]Event, 0)
+	for _, event := range events {
+		for _, _type := range w.Events {
+			if EventType(_type) == event.Type {
+				res = append(res, event)
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (w *Webhook) post(ctx context.Context, payload interface{}) error {
+	resp, err := w.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(payload).
+		Post(w.URL)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", w.URL, err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("webhook %s: %s", w.URL, resp.Status())
+	}
+	return nil
+}
+
+//=================================================================
+// Payloads
+
+const messageTitle = "Forcepoint NGFW licenses changes"
+
+func messageLines(events []Event) []string {
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		line := event.String()
+		if event.Company != "" {
+			line += " (" + event.Company + ")"
+		}
+		if event.Error != "" {
+			line += ": " + event.Error
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// slackPayload is a Slack incoming webhook message
+func slackPayload(events []Event) interface{} {
+	return map[string]string{
+		"text": "*" + messageTitle + "*\n• " + strings.Join(messageLines(events), "\n• "),
+	}
+}
+
+// teamsPayload is a Microsoft Teams incoming webhook message card
+func teamsPayload(events []Event) interface{} {
+	return map[string]string{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  messageTitle,
+		"title":    messageTitle,
+		"text":     "- " + strings.Join(messageLines(events), "\n- "),
+	}
+}
+
+//=================================================================
+// Notify
+
+// Send posts events to every webhook, a failing webhook does not prevent the
+// others from being notified
+func Send(ctx context.Context, hooks []config.Webhook, events []Event) error {
+	failed := make([]string, 0)
+	for _, hook := range hooks {
+		w, err := NewWebhook(hook)
+		if err == nil {
+			err = w.Notify(ctx, events)
+		}
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to notify: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
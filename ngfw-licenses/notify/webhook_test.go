@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+)
+
+// webhookServer records the JSON bodies posted to it
+type webhookServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func newWebhookServer(t *testing.T, status int) *webhookServer {
+	srv := &webhookServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("invalid webhook request %s: %v", data, err)
+		}
+		srv.mu.Lock()
+		srv.bodies = append(srv.bodies, body)
+		srv.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	events := Events(testReport(t))
+
+	tests := []struct {
+		format   string
+		filter   []string
+		wantPost int
+		check    func(body map[string]interface{}) bool
+	}{
+		{"", nil, 4, func(body map[string]interface{}) bool { return body["event"] != nil && body["pox"] != nil }},
+		{FormatJSON, []string{string(BindingChanged)}, 1, func(body map[string]interface{}) bool { return body["event"] == string(BindingChanged) }},
+		{FormatSlack, nil, 1, func(body map[string]interface{}) bool {
+			return strings.Contains(body["text"].(string), "REGISTRATION_ERROR")
+		}},
+		{FormatTeams, nil, 1, func(body map[string]interface{}) bool {
+			return body["@type"] == "MessageCard" && strings.Contains(body["text"].(string), "binding changed")
+		}},
+		{FormatSlack, []string{"unknown"}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			srv := newWebhookServer(t, http.StatusOK)
+			hook, err := NewWebhook(config.Webhook{URL: srv.URL, Format: tt.format, Events: tt.filter})
+			if err != nil {
+				t.Fatalf("NewWebhook() error = %v", err)
+			}
+			if err := hook.Notify(context.Background(), events); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if len(srv.bodies) != tt.wantPost {
+				t.Fatalf("%d POST, want %d", len(srv.bodies), tt.wantPost)
+			}
+			for _, body := range srv.bodies {
+				if !tt.check(body) {
+					t.Errorf("unexpected payload %v", body)
+				}
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	ok, failing := newWebhookServer(t, http.StatusOK), newWebhookServer(t, http.StatusInternalServerError)
+
+	err := Send(context.Background(), []config.Webhook{
+		{URL: failing.URL, Format: FormatSlack},
+		{URL: ok.URL, Format: FormatSlack},
+		{URL: ok.URL, Format: "xml"},
+	}, Events(testReport(t)))
+
+	if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "xml") {
+		t.Errorf("Send() error = %v, want the failing webhooks", err)
+	}
+	if len(ok.bodies) != 1 {
+		t.Errorf("%d POST, want 1", len(ok.bodies))
+	}
+}
@@ -0,0 +1,143 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+//=================================================================
+// LicensePortal
+
+const (
+	DefaultBaseURL = "https://stonesoftlicenses.forcepoint.com"
+
+	LoadPath          = "/license/load.do"
+	RegisterPath      = "/license/registerstonegate/save.do"
+	ChangeAddressPath = "/license/changeaddress/save.do"
+	LicenseFilePath   = "/license/licensefile.do"
+)
+
+// ErrPermissionDenied is returned when the portal throttles its clients
+var ErrPermissionDenied = errors.New("permission denied")
+
+// StatusError is returned when the portal answers with an HTTP error status
+type StatusError struct {
+	Path       string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Status)
+}
+
+// IsPermissionDenied tells if body is the page displayed when the portal
+// throttles its clients
+func IsPermissionDenied(body []byte) bool {
+	return bytes.Contains(body, []byte("Permission denied"))
+}
+
+// LicensePortal is the set of operations offered by the Forcepoint license center.
+// The portal works with sessions: Register and ChangeAddress apply to the PoS/PoL
+// previously loaded with the same identifier.
+type LicensePortal interface {
+	// Load returns the license page of a PoS/PoL
+	Load(ctx context.Context, identifier string) ([]byte, error)
+	// Register submits the registration form of a purchased PoS/PoL
+	Register(ctx context.Context, identifier string, formData map[string]string) ([]byte, error)
+	// ChangeAddress submits the binding change form of a registered PoL
+	ChangeAddress(ctx context.Context, identifier string, formData map[string]string) ([]byte, error)
+	// LicenseFile returns the content of a generated license file
+	LicenseFile(ctx context.Context, identifier, file string) ([]byte, error)
+}
+
+// NewPortal returns the HTTPPortal for baseURL, its calls being rate limited
+// and retried
+func NewPortal(baseURL string, retry RetryPolicy, rateLimit RateLimit) LicensePortal {
+	return WithRetry(WithRateLimit(NewHTTPPortal(baseURL), NewRateLimiter(rateLimit)), retry)
+}
+
+//=================================================================
+// HTTPPortal
+
+// HTTPPortal is the LicensePortal reached over HTTP, BaseURL being the
+// Forcepoint license center or anything serving the same pages.
+// Each identifier gets its own HTTP client, and so its own session cookies.
+type HTTPPortal struct {
+	BaseURL string
+
+	mu      sync.Mutex
+	clients map[string]*resty.Client
+}
+
+func NewHTTPPortal(baseURL string) *HTTPPortal {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &HTTPPortal{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		clients: make(map[string]*resty.Client),
+	}
+}
+
+func (p *HTTPPortal) client(identifier string) *resty.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.clients[identifier]
+	if !ok {
+		c = resty.New()
+		p.clients[identifier] = c
+	}
+	return c
+}
+
+func (p *HTTPPortal) Load(ctx context.Context, identifier string) ([]byte, error) {
+	return p.postForm(ctx, identifier, LoadPath, map[string]string{"licenseIdentification": identifier})
+}
+
+func (p *HTTPPortal) Register(ctx context.Context, identifier string, formData map[string]string) ([]byte, error) {
+	return p.postForm(ctx, identifier, RegisterPath, formData)
+}
+
+func (p *HTTPPortal) ChangeAddress(ctx context.Context, identifier string, formData map[string]string) ([]byte, error) {
+	return p.postForm(ctx, identifier, ChangeAddressPath, formData)
+}
+
+func (p *HTTPPortal) LicenseFile(ctx context.Context, identifier, file string) ([]byte, error) {
+	resp, err := p.client(identifier).R().
+		SetContext(ctx).
+		SetQueryParam("file", file).
+		Get(p.BaseURL + LicenseFilePath)
+
+	return checkResponse(LicenseFilePath, resp, err)
+}
+
+func (p *HTTPPortal) postForm(ctx context.Context, identifier, path string, formData map[string]string) ([]byte, error) {
+	resp, err := p.client(identifier).R().
+		SetContext(ctx).
+		SetFormData(formData).
+		Post(p.BaseURL + path)
+
+	return checkResponse(path, resp, err)
+}
+
+func checkResponse(path string, resp *resty.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return resp.Body(), &StatusError{Path: path, StatusCode: resp.StatusCode(), Status: resp.Status()}
+	}
+	if IsPermissionDenied(resp.Body()) {
+		return resp.Body(), fmt.Errorf("%s: %w", path, ErrPermissionDenied)
+	}
+
+	return resp.Body(), nil
+}
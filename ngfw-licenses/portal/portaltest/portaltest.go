@@ -0,0 +1,316 @@
+// Package portaltest provides a fake Forcepoint license center for tests,
+// in the spirit of net/http/httptest.
+package portaltest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
+)
+
+const sessionCookie = "JSESSIONID"
+
+//=================================================================
+// License
+
+// License is the portal side view of a PoS/PoL
+type License struct {
+	Identifier         string
+	IsPoL              bool
+	Status             string
+	LicenseID          string
+	ProductName        string
+	Binding            string
+	Platform           string
+	LicensePeriod      string
+	LicenseFile        string
+	MaintenanceStatus  string
+	MaintenanceEndDate string
+	SerialNumber       string
+	Company            string
+	Spare              bool
+	// FileContent replaces the generated license file when set
+	FileContent []byte
+
+	// pending registration or binding change, applied once readyAt is reached
+	pending *pending
+}
+
+type pending struct {
+	readyAt time.Time
+	binding string
+	company string
+	status  string
+}
+
+//=================================================================
+// Server
+
+// Server is a fake license portal serving load.do, registerstonegate/save.do,
+// changeaddress/save.do and licensefile.do
+type Server struct {
+	*httptest.Server
+
+	// RegistrationDelay is the time needed by the portal to apply a
+	// registration or a binding change
+	RegistrationDelay time.Duration
+
+	mu        sync.Mutex
+	licenses  map[string]*License
+	sessions  map[string]string
+	requests  map[string]int
+	nextID    int
+	throttled int
+}
+
+// NewServer starts a Server, to be closed by the caller
+func NewServer() *Server {
+	s := &Server{
+		licenses: make(map[string]*License),
+		sessions: make(map[string]string),
+		requests: make(map[string]int),
+		nextID:   100000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(portal.LoadPath, s.throttle(s.handleLoad))
+	mux.HandleFunc(portal.RegisterPath, s.throttle(s.handleRegister))
+	mux.HandleFunc(portal.ChangeAddressPath, s.throttle(s.handleChangeAddress))
+	mux.HandleFunc(portal.LicenseFilePath, s.throttle(s.handleLicenseFile))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AddPoS adds a purchased PoS appliance license
+func (s *Server) AddPoS(pos string) *License {
+	return s.add(&License{
+		Identifier:         pos,
+		Status:             "PURCHASED",
+		ProductName:        "Forcepoint NGFW 120W Appliance",
+		Platform:           "Appliance",
+		SerialNumber:       "N0C" + pos[:9],
+		MaintenanceStatus:  "Activated",
+		MaintenanceEndDate: "2023-12-22",
+	})
+}
+
+// AddPoL adds a purchased PoL virtual license
+func (s *Server) AddPoL(pol string) *License {
+	return s.add(&License{
+		Identifier:         pol,
+		IsPoL:              true,
+		Status:             "PURCHASED",
+		ProductName:        "Forcepoint NGFW Virtual Appliance",
+		Platform:           "Linux",
+		LicensePeriod:      "Permanent",
+		MaintenanceStatus:  "Activated",
+		MaintenanceEndDate: "2023-12-22",
+	})
+}
+
+func (s *Server) add(l *License) *License {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	l.LicenseID = strconv.Itoa(s.nextID)
+	s.licenses[l.Identifier] = l
+	return l
+}
+
+// Get returns a copy of the license as currently seen by the portal
+func (s *Server) Get(identifier string) (License, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.licenses[identifier]
+	if !ok {
+		return License{}, false
+	}
+	s.applyPending(l)
+	return *l, true
+}
+
+// Throttle makes the portal answer "Permission denied" to the next n requests
+func (s *Server) Throttle(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.throttled = n
+}
+
+// Requests returns the number of requests received on the given path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+//=================================================================
+// Handlers
+
+func (s *Server) throttle(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		throttled := s.throttled > 0
+		if throttled {
+			s.throttled--
+			s.requests[r.URL.Path]++
+		}
+		s.mu.Unlock()
+
+		if throttled {
+			writePage(w, errorTemplate, "Permission denied")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleLoad(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[portal.LoadPath]++
+
+	identifier := r.PostFormValue("licenseIdentification")
+	l, ok := s.licenses[identifier]
+	if !ok {
+		writePage(w, notFoundTemplate, nil)
+		return
+	}
+
+	sessionID := fmt.Sprintf("%s-%d", identifier, s.requests[portal.LoadPath])
+	s.sessions[sessionID] = identifier
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: sessionID, Path: "/"})
+
+	s.applyPending(l)
+	writePage(w, licenseTemplate, l)
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[portal.RegisterPath]++
+
+	l, ok := s.sessionLicense(r)
+	if !ok || l.Status != "PURCHASED" || r.PostFormValue("terms") != "true" {
+		w.WriteHeader(http.StatusBadRequest)
+		writePage(w, errorTemplate, "Unable to register this license")
+		return
+	}
+
+	p := &pending{
+		readyAt: time.Now().Add(s.RegistrationDelay),
+		company: r.PostFormValue("company"),
+		status:  "REGISTERED",
+	}
+	if l.IsPoL {
+		p.binding = r.PostFormValue("binding[1]")
+	} else {
+		p.binding = l.Identifier
+	}
+	l.pending = p
+	s.applyPending(l)
+
+	writePage(w, errorTemplate, "")
+}
+
+func (s *Server) handleChangeAddress(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[portal.ChangeAddressPath]++
+
+	l, ok := s.sessionLicense(r)
+	if !ok || !l.IsPoL || l.Status != "REGISTERED" {
+		w.WriteHeader(http.StatusBadRequest)
+		writePage(w, errorTemplate, "Unable to change the binding of this license")
+		return
+	}
+
+	l.pending = &pending{
+		readyAt: time.Now().Add(s.RegistrationDelay),
+		binding: r.PostFormValue("binding[1]"),
+		company: l.Company,
+		status:  l.Status,
+	}
+	s.applyPending(l)
+
+	writePage(w, errorTemplate, "")
+}
+
+func (s *Server) handleLicenseFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[portal.LicenseFilePath]++
+
+	file := r.URL.Query().Get("file")
+	for _, l := range s.licenses {
+		s.applyPending(l)
+		if file != "" && l.LicenseFile == file {
+			w.Header().Set("Content-Type", "application/java-archive")
+			if l.FileContent != nil {
+				w.Write(l.FileContent)
+				return
+			}
+			w.Write(licenseFileContent(l))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	writePage(w, errorTemplate, "License file not found")
+}
+
+//=================================================================
+// Helpers
+
+func (s *Server) sessionLicense(r *http.Request) (*License, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	l, ok := s.licenses[s.sessions[c.Value]]
+	return l, ok
+}
+
+func (s *Server) applyPending(l *License) {
+	if l.pending == nil || time.Now().Before(l.pending.readyAt) {
+		return
+	}
+
+	l.Status = l.pending.status
+	l.Binding = l.pending.binding
+	l.Company = l.pending.company
+	l.LicenseFile = fmt.Sprintf("%s-%s.jar", l.LicenseID, time.Now().Format("20060102150405"))
+	l.pending = nil
+}
+
+func licenseFileContent(l *License) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	f, _ := zw.Create("META-INF/MANIFEST.MF")
+	fmt.Fprintf(f, "Manifest-Version: 1.0\r\nCreated-By: portaltest\r\n")
+
+	f, _ = zw.Create("license.properties")
+	fmt.Fprintf(f, "license.id=%s\nproduct=%s\nbinding=%s\nplatform=%s\nmaintenance.end=%s\n",
+		l.LicenseID, l.ProductName, l.Binding, l.Platform, l.MaintenanceEndDate)
+
+	zw.Close()
+	return buf.Bytes()
+}
+
+func writePage(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t.Execute(w, data)
+}
@@ -0,0 +1,54 @@
+package portaltest
+
+import "html/template"
+
+// Pages mimic the markup of the Forcepoint license center, as expected by the
+// pagser selectors of pox.PoX
+
+const header = `<!DOCTYPE html>
+<html>
+<head><title>Forcepoint Licensing</title></head>
+<body>
+<div id="MSC_Content">
+`
+
+const footer = `</div>
+</body>
+</html>
+`
+
+var (
+	licenseTemplate = template.Must(template.New("license").Parse(header + `<h2>{{.ProductName}}</h2>
+<h3>License ID : {{.LicenseID}}</h3>
+<table>
+<thead><tr><th>Status</th><th>Binding</th><th>Binding Type</th><th>Platform</th><th>License Period</th></tr></thead>
+<tbody><tr><td>{{.Status}}</td><td>{{.Binding}}</td><td>{{if .IsPoL}}POL{{else}}POS{{end}}</td><td>{{.Platform}}</td><td>{{.LicensePeriod}}</td></tr></tbody>
+</table>
+{{if .LicenseFile}}<table>
+<caption>License File</caption>
+<thead><tr><th>File</th></tr></thead>
+<tbody><tr><td>{{.LicenseFile}}</td></tr></tbody>
+</table>
+{{end}}<table>
+<caption>Support & Maintenance</caption>
+<thead><tr><th>Status</th><th>End Date</th></tr></thead>
+<tbody>{{if .Spare}}<tr><th>No Support & Maintenance</th></tr>{{else}}<tr><td>{{.MaintenanceStatus}}</td><td>{{.MaintenanceEndDate}}</td></tr>{{end}}</tbody>
+</table>
+{{if not .IsPoL}}<table>
+<caption>Appliance Hardware</caption>
+<thead><tr><th>Serial Number</th></tr></thead>
+<tbody><tr><td>{{.SerialNumber}}</td></tr></tbody>
+</table>
+{{end}}{{if .Company}}<table>
+<caption>License Company</caption>
+<thead><tr><th>Company</th></tr></thead>
+<tbody><tr><td>{{.Company}}</td></tr></tbody>
+</table>
+{{end}}` + footer))
+
+	notFoundTemplate = template.Must(template.New("notFound").Parse(header + `<p class="error">No license found with the given identifier</p>
+` + footer))
+
+	errorTemplate = template.Must(template.New("error").Parse(header + `{{if .}}<p class="error">{{.}}</p>
+{{end}}` + footer))
+)
@@ -0,0 +1,166 @@
+package portal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+//=================================================================
+// RateLimiter
+
+// RateLimit defines the rate of the requests sent to the portal, shared by all
+// workers. A zero RequestsPerSecond disables the rate limiting.
+type RateLimit struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+var DefaultRateLimit = RateLimit{
+	RequestsPerSecond: 5,
+	Burst:             10,
+}
+
+const (
+	// minRateDivisor bounds how much the rate can be lowered on throttling
+	minRateDivisor = 16
+	// recoverySteps is the number of successful requests needed to get back
+	// from the minimal rate to the configured one
+	recoverySteps = 20
+)
+
+// RateLimiter is a token bucket. Its rate is halved each time the portal
+// throttles us, and then slowly recovers on successful requests.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	maxRate float64
+	minRate float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+}
+
+// NewRateLimiter returns a RateLimiter, or nil when the rate limiting is disabled
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	if limit.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := math.Max(1, float64(limit.Burst))
+	return &RateLimiter{
+		rate:    limit.RequestsPerSecond,
+		maxRate: limit.RequestsPerSecond,
+		minRate: limit.RequestsPerSecond / minRateDivisor,
+		burst:   burst,
+		tokens:  burst,
+		last:    time.Now(),
+	}
+}
+
+// Wait blocks until a request can be sent, or until ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// the token is reserved right now, even if it has to be waited for
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Throttled halves the rate and drops the remaining burst
+func (l *RateLimiter) Throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = math.Max(l.minRate, l.rate/2)
+	l.tokens = math.Min(0, l.tokens)
+}
+
+// Succeeded raises the rate back to the configured one, step by step
+func (l *RateLimiter) Succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = math.Min(l.maxRate, l.rate+(l.maxRate-l.minRate)/recoverySteps)
+}
+
+// Rate returns the current rate, in requests per second
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+//=================================================================
+// rateLimitedPortal
+
+type rateLimitedPortal struct {
+	LicensePortal
+	limiter *RateLimiter
+}
+
+// WithRateLimit returns a LicensePortal sending the calls to p at the pace of
+// limiter, a nil limiter disables the rate limiting
+func WithRateLimit(p LicensePortal, limiter *RateLimiter) LicensePortal {
+	if limiter == nil {
+		return p
+	}
+	return &rateLimitedPortal{LicensePortal: p, limiter: limiter}
+}
+
+func (p *rateLimitedPortal) do(ctx context.Context, call func() ([]byte, error)) ([]byte, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	body, err := call()
+	switch {
+	case errors.Is(err, ErrPermissionDenied):
+		p.limiter.Throttled()
+	case err == nil:
+		p.limiter.Succeeded()
+	}
+
+	return body, err
+}
+
+func (p *rateLimitedPortal) Load(ctx context.Context, identifier string) ([]byte, error) {
+	return p.do(ctx, func() ([]byte, error) {
+		return p.LicensePortal.Load(ctx, identifier)
+	})
+}
+
+func (p *rateLimitedPortal) Register(ctx context.Context, identifier string, formData map[string]string) ([]byte, error) {
+	return p.do(ctx, func() ([]byte, error) {
+		return p.LicensePortal.Register(ctx, identifier, formData)
+	})
+}
+
+func (p *rateLimitedPortal) ChangeAddress(ctx context.Context, identifier string, formData map[string]string) ([]byte, error) {
+	return p.do(ctx, func() ([]byte, error) {
+		return p.LicensePortal.ChangeAddress(ctx, identifier, formData)
+	})
+}
+
+func (p *rateLimitedPortal) LicenseFile(ctx context.Context, identifier, file string) ([]byte, error) {
+	return p.do(ctx, func() ([]byte, error) {
+		return p.LicensePortal.LicenseFile(ctx, identifier, file)
+	})
+}
@@ -0,0 +1,77 @@
+package portal_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal/portaltest"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	l := portal.NewRateLimiter(portal.RateLimit{RequestsPerSecond: 100, Burst: 5})
+
+	// 4 workers sending 16 requests: 5 from the burst, then 11 at 100 per second
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				l.Wait(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("16 requests sent in %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestRateLimiter_Adapt(t *testing.T) {
+	l := portal.NewRateLimiter(portal.RateLimit{RequestsPerSecond: 16, Burst: 1})
+
+	l.Throttled()
+	if got := l.Rate(); got != 8 {
+		t.Errorf("Rate() = %v after throttling, want 8", got)
+	}
+	for i := 0; i < 10; i++ {
+		l.Throttled()
+	}
+	if got := l.Rate(); got != 1 {
+		t.Errorf("Rate() = %v after throttling, want the minimal rate 1", got)
+	}
+	for i := 0; i < 100; i++ {
+		l.Succeeded()
+	}
+	if got := l.Rate(); got != 16 {
+		t.Errorf("Rate() = %v after recovery, want 16", got)
+	}
+
+	if l := portal.NewRateLimiter(portal.RateLimit{}); l != nil {
+		t.Errorf("NewRateLimiter() = %v, want nil when disabled", l)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	const pos = "0123456789-abcdef0123"
+
+	srv := portaltest.NewServer()
+	defer srv.Close()
+	srv.AddPoS(pos)
+	srv.Throttle(2)
+
+	l := portal.NewRateLimiter(portal.RateLimit{RequestsPerSecond: 1000, Burst: 10})
+	p := portal.WithRetry(portal.WithRateLimit(portal.NewHTTPPortal(srv.URL), l), testRetryPolicy)
+	if _, err := p.Load(context.Background(), pos); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := l.Rate(); got >= 1000 {
+		t.Errorf("Rate() = %v, want it lowered after throttling", got)
+	}
+}
@@ -0,0 +1,169 @@
+package portal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+)
+
+//=================================================================
+// RetryPolicy
+
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryPolicy defines how portal calls are retried when the portal is
+// unreachable or answers "Permission denied". Register and ChangeAddress are
+// retried only when their form has not been submitted, see submitRetryable.
+type RetryPolicy struct {
+	MaxAttempts     int           `mapstructure:"max_attempts"`
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	MaxInterval     time.Duration `mapstructure:"max_interval"`
+	Multiplier      float64       `mapstructure:"multiplier"`
+	Jitter          float64       `mapstructure:"jitter"`
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     6,
+	InitialInterval: 2 * time.Second,
+	MaxInterval:     time.Minute,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// Backoff returns the time to wait before the given attempt, attempt 1 being
+// the first retry
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && d > float64(p.MaxInterval) {
+		d = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// RetryError is returned when all attempts failed, Err being the last error
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v after %d attempts: %v", ErrRetriesExhausted, e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryError) Is(target error) bool {
+	return target == ErrRetriesExhausted
+}
+
+// retryable tells if a call which failed with err is worth another attempt
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == 429
+	}
+	return true
+}
+
+// submitRetryable tells if a form submission which failed with err is worth
+// another attempt. Submissions are not idempotent: they are retried only when
+// the request never reached the portal, or when the portal rejected it.
+func submitRetryable(err error) bool {
+	if errors.Is(err, ErrPermissionDenied) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == 429 || statusErr.StatusCode == 503
+	}
+	return NotSent(err)
+}
+
+// NotSent tells if err proves the request never reached the portal: its name
+// could not be resolved, or the connection could not be established
+func NotSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+//=================================================================
+// retryPortal
+
+type retryPortal struct {
+	LicensePortal
+	policy RetryPolicy
+}
+
+// WithRetry returns a LicensePortal retrying the calls to p according to policy
+func WithRetry(p LicensePortal, policy RetryPolicy) LicensePortal {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &retryPortal{LicensePortal: p, policy: policy}
+}
+
+// do calls call until it succeeds, fails with an error retryable does not
+// accept, or the attempts are exhausted
+func (p *retryPortal) do(ctx context.Context, retryable func(error) bool, call func() ([]byte, error)) ([]byte, error) {
+	var (
+		body []byte
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		body, err = call()
+		if err == nil || !retryable(err) {
+			return body, err
+		}
+		if attempt >= p.policy.MaxAttempts {
+			return body, &RetryError{Attempts: attempt, Err: err}
+		}
+
+		select {
+		case <-time.After(p.policy.Backoff(attempt)):
+		case <-ctx.Done():
+			return body, ctx.Err()
+		}
+	}
+}
+
+func (p *retryPortal) Load(ctx context.Context, identifier string) ([]byte, error) {
+	return p.do(ctx, retryable, func() ([]byte, error) {
+		return p.LicensePortal.Load(ctx, identifier)
+	})
+}
+
+func (p *retryPortal) Register(ctx context.Context, identifier string, formData map[string]string) ([]byte, error) {
+	return p.do(ctx, submitRetryable, func() ([]byte, error) {
+		return p.LicensePortal.Register(ctx, identifier, formData)
+	})
+}
+
+func (p *retryPortal) ChangeAddress(ctx context.Context, identifier string, formData map[string]string) ([]byte, error) {
+	return p.do(ctx, submitRetryable, func() ([]byte, error) {
+		return p.LicensePortal.ChangeAddress(ctx, identifier, formData)
+	})
+}
+
+func (p *retryPortal) LicenseFile(ctx context.Context, identifier, file string) ([]byte, error) {
+	return p.do(ctx, retryable, func() ([]byte, error) {
+		return p.LicensePortal.LicenseFile(ctx, identifier, file)
+	})
+}
@@ -0,0 +1,142 @@
+package portal_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal/portaltest"
+)
+
+var testRetryPolicy = portal.RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: time.Millisecond,
+	MaxInterval:     5 * time.Millisecond,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := portal.RetryPolicy{InitialInterval: time.Second, MaxInterval: 10 * time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Backoff(2) = %v, want between 1s and 3s", got)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	const pos = "0123456789-abcdef0123"
+
+	tests := []struct {
+		name         string
+		throttled    int
+		wantErr      error
+		wantRequests int
+	}{
+		{"no throttling", 0, nil, 1},
+		{"throttled then ok", 2, nil, 3},
+		{"always throttled", 10, portal.ErrRetriesExhausted, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := portaltest.NewServer()
+			defer srv.Close()
+			srv.AddPoS(pos)
+			srv.Throttle(tt.throttled)
+
+			p := portal.WithRetry(portal.NewHTTPPortal(srv.URL), testRetryPolicy)
+			_, err := p.Load(context.Background(), pos)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, portal.ErrPermissionDenied) {
+				t.Errorf("Load() error = %v, want it to wrap %v", err, portal.ErrPermissionDenied)
+			}
+			if got := srv.Requests(portal.LoadPath); got != tt.wantRequests {
+				t.Errorf("%d requests sent, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWithRetry_NotRetryable(t *testing.T) {
+	srv := portaltest.NewServer()
+	defer srv.Close()
+
+	p := portal.WithRetry(portal.NewHTTPPortal(srv.URL), testRetryPolicy)
+	_, err := p.LicenseFile(context.Background(), "0123456789-abcdef0123", "unknown.jar")
+
+	var statusErr *portal.StatusError
+	if !errors.As(err, &statusErr) || errors.Is(err, portal.ErrRetriesExhausted) {
+		t.Errorf("LicenseFile() error = %v, want a StatusError without retries", err)
+	}
+	if got := srv.Requests(portal.LicenseFilePath); got != 1 {
+		t.Errorf("%d requests sent, want 1", got)
+	}
+}
+
+func TestWithRetry_Submit(t *testing.T) {
+	const pos = "0123456789-abcdef0123"
+
+	// the connection is closed once the form has been read: it may have been
+	// processed, it must not be submitted again
+	var requests int32
+	sent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		r.ParseForm()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer sent.Close()
+
+	p := portal.WithRetry(portal.NewHTTPPortal(sent.URL), testRetryPolicy)
+	if _, err := p.Register(context.Background(), pos, map[string]string{"a": "b"}); err == nil || errors.Is(err, portal.ErrRetriesExhausted) {
+		t.Errorf("Register() error = %v, want an error without retries", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("%d registrations sent, want 1", got)
+	}
+
+	// a closed port refuses the connection: nothing has been sent
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	p = portal.WithRetry(portal.NewHTTPPortal(unreachable.URL), testRetryPolicy)
+	if _, err := p.ChangeAddress(context.Background(), pos, map[string]string{"a": "b"}); !errors.Is(err, portal.ErrRetriesExhausted) || !portal.NotSent(err) {
+		t.Errorf("ChangeAddress() error = %v, want retries exhausted on a dial error", err)
+	}
+
+	// the portal throttling a submission rejects it
+	srv := portaltest.NewServer()
+	defer srv.Close()
+	srv.AddPoS(pos)
+	srv.Throttle(10)
+	p = portal.WithRetry(portal.NewHTTPPortal(srv.URL), testRetryPolicy)
+	if _, err := p.Register(context.Background(), pos, map[string]string{}); !errors.Is(err, portal.ErrRetriesExhausted) {
+		t.Errorf("Register() error = %v, want retries exhausted", err)
+	}
+	if got := srv.Requests(portal.RegisterPath); got != testRetryPolicy.MaxAttempts {
+		t.Errorf("%d registrations sent, want %d", got, testRetryPolicy.MaxAttempts)
+	}
+}
@@ -0,0 +1,171 @@
+package pox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// Snapshot
+
+// Snapshot is the JSON form of a PoXList, as written by verify --format json
+type Snapshot struct {
+	PoLList PoXList `json:"pol_list,omitempty"`
+	PoSList PoXList `json:"pos_list,omitempty"`
+}
+
+func (poxList PoXList) Snapshot() Snapshot {
+	return Snapshot{
+		PoLList: poxList.GetAllPoL(),
+		PoSList: poxList.GetAllPoS(),
+	}
+}
+
+// ReadSnapshot reads a PoXList written by verify --format json
+func ReadSnapshot(filename string) (PoXList, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("unable to read snapshot %s: %w", filename, err)
+	}
+
+	return append(snapshot.PoLList, snapshot.PoSList...), nil
+}
+
+//=================================================================
+// Diff
+
+// Change is a field which changed between two snapshots
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// PoXChanges are the changes of a PoS/PoL present in both snapshots
+type PoXChanges struct {
+	PoX     *PoX
+	Changes []Change
+}
+
+func (c PoXChanges) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		PoX     string   `json:"pox"`
+		Type    PoXType  `json:"type"`
+		Changes []Change `json:"changes"`
+	}{
+		PoX:     c.PoX.pox,
+		Type:    c.PoX.poxType,
+		Changes: c.Changes,
+	})
+}
+
+// Diff is the difference between two snapshots
+type Diff struct {
+	Added   PoXList      `json:"added"`
+	Removed PoXList      `json:"removed"`
+	Changed []PoXChanges `json:"changed"`
+}
+
+// diffFields are the fields compared by NewDiff, named after their JSON name
+var diffFields = []struct {
+	name  string
+	value func(pox *PoX) string
+}{
+	{"licence_status", func(pox *PoX) string { return string(pox.Status) }},
+	{"binding", func(pox *PoX) string { return pox.Binding }},
+	{"serial_number", func(pox *PoX) string { return pox.SerialNumber }},
+	{"company", func(pox *PoX) string { return pox.Company }},
+	{"support_end_date", func(pox *PoX) string { return pox.MaintenanceEndDate }},
+}
+
+// NewDiff compares the PoS/PoL of two snapshots
+func NewDiff(before, after PoXList) *Diff {
+	diff := &Diff{Added: make(PoXList, 0), Removed: make(PoXList, 0), Changed: make([]PoXChanges, 0)}
+
+	oldByID := before.byIdentifier()
+	newByID := after.byIdentifier()
+
+	for id, n := range newByID {
+		o, ok := oldByID[id]
+		if !ok {
+			diff.Added = append(diff.Added, n)
+			continue
+		}
+
+		changes := make([]Change, 0)
+		for _, field := range diffFields {
+			if ov, nv := field.value(o), field.value(n); ov != nv {
+				changes = append(changes, Change{Field: field.name, Old: ov, New: nv})
+			}
+		}
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, PoXChanges{PoX: n, Changes: changes})
+		}
+	}
+	for id, o := range oldByID {
+		if _, ok := newByID[id]; !ok {
+			diff.Removed = append(diff.Removed, o)
+		}
+	}
+
+	diff.Added.sort()
+	diff.Removed.sort()
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].PoX.pox < diff.Changed[j].PoX.pox })
+
+	return diff
+}
+
+// Empty tells if both snapshots hold the same PoS/PoL, with the same fields
+func (diff *Diff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+func (diff *Diff) Display() {
+	if diff.Empty() {
+		fmt.Println("No difference")
+		return
+	}
+
+	if len(diff.Added) > 0 {
+		fmt.Printf("\n%d PoS/PoL added:\n", len(diff.Added))
+		for _, pox := range diff.Added {
+			fmt.Printf("%s %v\n", aurora.Green("+"), pox.DetailedString())
+		}
+	}
+	if len(diff.Removed) > 0 {
+		fmt.Printf("\n%d PoS/PoL removed:\n", len(diff.Removed))
+		for _, pox := range diff.Removed {
+			fmt.Printf("%s %v\n", aurora.Red("-"), pox.DetailedString())
+		}
+	}
+	if len(diff.Changed) > 0 {
+		fmt.Printf("\n%d PoS/PoL changed:\n", len(diff.Changed))
+		for _, c := range diff.Changed {
+			fmt.Printf("%s %v\n", aurora.Yellow("~"), c.PoX)
+			for _, change := range c.Changes {
+				fmt.Printf("    %s: \"%s\" -> \"%s\"\n", change.Field, change.Old, aurora.Yellow(change.New))
+			}
+		}
+	}
+}
+
+func (poxList PoXList) byIdentifier() map[string]*PoX {
+	res := make(map[string]*PoX, len(poxList))
+	for _, pox := range poxList {
+		res[pox.pox] = pox
+	}
+	return res
+}
+
+func (poxList PoXList) sort() {
+	sort.Slice(poxList, func(i, j int) bool { return poxList[i].pox < poxList[j].pox })
+}
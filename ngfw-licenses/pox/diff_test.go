@@ -0,0 +1,65 @@
+package pox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+func TestNewDiff(t *testing.T) {
+	pos1, pos2, pol1 := mustNewPoS(testPoS1), mustNewPoS(testPoS2), mustNewPoL(testPoL1)
+	pos1.Status = statutes.Purchased
+	pol1.Status, pol1.Binding = statutes.Registered, "192.168.1.1"
+
+	pos1After, pos3, pol1After := mustNewPoS(testPoS1), mustNewPoS(testPoS3), mustNewPoL(testPoL1)
+	pos1After.Status, pos1After.SerialNumber, pos1After.Company = statutes.Registered, "N0C012345678", "My Corp"
+	pol1After.Status, pol1After.Binding = statutes.Registered, "192.168.1.1"
+
+	diff := NewDiff(PoXList{pos1, pos2, pol1}, PoXList{pol1After, pos3, pos1After})
+
+	if len(diff.Added) != 1 || diff.Added[0].pox != testPoS3 {
+		t.Errorf("Added = %v, want %s", diff.Added, testPoS3)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].pox != testPoS2 {
+		t.Errorf("Removed = %v, want %s", diff.Removed, testPoS2)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].PoX.pox != testPoS1 {
+		t.Fatalf("Changed = %+v, want %s", diff.Changed, testPoS1)
+	}
+	want := []Change{
+		{"licence_status", "PURCHASED", "REGISTERED"},
+		{"serial_number", "", "N0C012345678"},
+		{"company", "", "My Corp"},
+	}
+	if got := diff.Changed[0].Changes; len(got) != len(want) {
+		t.Errorf("Changes = %+v, want %+v", got, want)
+	} else {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Changes[%d] = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+
+	if !NewDiff(PoXList{pol1}, PoXList{pol1After}).Empty() {
+		t.Errorf("Empty() = false, want true")
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	pos, pol := mustNewPoS(testPoS1), mustNewPoL(testPoL1)
+	pos.Status, pol.Status = statutes.Registered, statutes.Purchased
+
+	data, _ := json.Marshal(PoXList{pos, pol}.Snapshot())
+	ioutil.WriteFile("snapshot.json", data, 0644)
+
+	poxList, err := ReadSnapshot("snapshot.json")
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	if !NewDiff(PoXList{pos, pol}, poxList).Empty() {
+		t.Errorf("ReadSnapshot() = %v, want %v", poxList, PoXList{pos, pol})
+	}
+}
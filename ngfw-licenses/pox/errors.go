@@ -0,0 +1,43 @@
+package pox
+
+import (
+	"errors"
+	"fmt"
+)
+
+//=================================================================
+// Errors
+
+var (
+	ErrInvalidIdentifier   = errors.New("invalid identifier")
+	ErrPortalUnreachable   = errors.New("license portal unreachable")
+	ErrParse               = errors.New("unable to parse license portal page")
+	ErrRegistrationTimeout = errors.New("registration timeout")
+	ErrMissingContactInfo  = errors.New("contact informations are missing from config file")
+	ErrInterrupted         = errors.New("interrupted")
+	ErrEmptyLicenseFile    = errors.New("empty license file")
+	ErrHTMLLicenseFile     = errors.New("HTML page instead of a license file")
+)
+
+// Error records the operation and the PoS/PoL which failed, Err being one of
+// the Err* variables above, possibly wrapped
+type Error struct {
+	Op  string
+	PoX string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.PoX, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(op, pox string, kind, err error) *Error {
+	if err == nil {
+		return &Error{Op: op, PoX: pox, Err: kind}
+	}
+	return &Error{Op: op, PoX: pox, Err: fmt.Errorf("%w: %v", kind, err)}
+}
@@ -0,0 +1,217 @@
+package pox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// Expiry
+
+// Expiry is a PoS/PoL whose support ends within one of the horizons, or has
+// ended within the largest one
+type Expiry struct {
+	PoX     *PoX      `json:"-"`
+	EndDate time.Time `json:"-"`
+	// DaysLeft is negative once the support has ended
+	DaysLeft int `json:"days_left"`
+	// Horizon is the smallest horizon the support ends within, 0 once ended
+	Horizon int `json:"horizon"`
+}
+
+// Critical tells if the support ends within criticalDays, supports already
+// ended are not
+func (e Expiry) Critical(criticalDays int) bool {
+	return e.DaysLeft >= 0 && e.DaysLeft <= criticalDays
+}
+
+// ExpiryGroup gathers the expiries of a company and product
+type ExpiryGroup struct {
+	Company     string   `json:"company"`
+	ProductName string   `json:"product_name"`
+	Expiries    []Expiry `json:"expiries"`
+}
+
+// ExpiryReport lists the PoS/PoL whose support ends within the largest horizon,
+// grouped by company and product. Those whose support has ended within the
+// largest horizon are listed apart, in Expired.
+type ExpiryReport struct {
+	Date         time.Time     `json:"date"`
+	Horizons     []int         `json:"horizons"`
+	CriticalDays int           `json:"critical_days"`
+	Groups       []ExpiryGroup `json:"groups"`
+	Expired      []ExpiryGroup `json:"expired"`
+}
+
+// Expiring returns the PoS/PoL whose support ends within horizons days from
+// now, or has ended within the largest one. Spare PoS/PoL, and the ones without
+// support end date, are left out.
+func (poxList PoXList) Expiring(now time.Time, horizons []int, criticalDays int) *ExpiryReport {
+	horizons = append([]int(nil), horizons...)
+	sort.Ints(horizons)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	report := &ExpiryReport{Date: today, Horizons: horizons, CriticalDays: criticalDays, Groups: make([]ExpiryGroup, 0), Expired: make([]ExpiryGroup, 0)}
+	if len(horizons) == 0 {
+		return report
+	}
+
+	groups := make(map[[2]string]*ExpiryGroup)
+	expired := make(map[[2]string]*ExpiryGroup)
+	for _, pox := range poxList {
+		end, ok := pox.MaintenanceEndTime()
+		if !ok {
+			continue
+		}
+		daysLeft := int(end.Sub(today).Hours() / 24)
+		if daysLeft < 0 {
+			if -daysLeft <= report.maxHorizon() {
+				addExpiry(expired, Expiry{PoX: pox, EndDate: end, DaysLeft: daysLeft})
+			}
+			continue
+		}
+		for _, h := range horizons {
+			if daysLeft <= h {
+				addExpiry(groups, Expiry{PoX: pox, EndDate: end, DaysLeft: daysLeft, Horizon: h})
+				break
+			}
+		}
+	}
+
+	report.Groups = sortedGroups(groups)
+	report.Expired = sortedGroups(expired)
+	return report
+}
+
+// addExpiry adds e to the group of its company and product
+func addExpiry(groups map[[2]string]*ExpiryGroup, e Expiry) {
+	key := [2]string{e.PoX.Company, e.PoX.ProductName}
+	group, ok := groups[key]
+	if !ok {
+		group = &ExpiryGroup{Company: e.PoX.Company, ProductName: e.PoX.ProductName}
+		groups[key] = group
+	}
+	group.Expiries = append(group.Expiries, e)
+}
+
+// sortedGroups returns the groups sorted by company and product, and their
+// expiries by days left
+func sortedGroups(groups map[[2]string]*ExpiryGroup) []ExpiryGroup {
+	res := make([]ExpiryGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group.Expiries, func(i, j int) bool { return group.Expiries[i].DaysLeft < group.Expiries[j].DaysLeft })
+		res = append(res, *group)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Company != res[j].Company {
+			return res[i].Company < res[j].Company
+		}
+		return res[i].ProductName < res[j].ProductName
+	})
+	return res
+}
+
+// Critical returns the expiries within the critical window
+func (r *ExpiryReport) Critical() []Expiry {
+	res := make([]Expiry, 0)
+	for _, group := range r.Groups {
+		for _, e := range group.Expiries {
+			if e.Critical(r.CriticalDays) {
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
+
+// Count returns the number of supports ending within the horizons
+func (r *ExpiryReport) Count() (res int) {
+	for _, group := range r.Groups {
+		res += len(group.Expiries)
+	}
+	return res
+}
+
+// CountExpired returns the number of supports ended within the largest horizon
+func (r *ExpiryReport) CountExpired() (res int) {
+	for _, group := range r.Expired {
+		res += len(group.Expiries)
+	}
+	return res
+}
+
+func (r *ExpiryReport) Display() {
+	if r.Count() == 0 && r.CountExpired() == 0 {
+		fmt.Printf("No support ending within %d days\n", r.maxHorizon())
+		return
+	}
+
+	for _, group := range r.Groups {
+		fmt.Printf("\n%s - %s:\n", aurora.Bold(companyName(group.Company)), group.ProductName)
+		for _, e := range group.Expiries {
+			left := fmt.Sprintf("%d days left", e.DaysLeft)
+			var when aurora.Value = aurora.Gray(12, left)
+			if e.Critical(r.CriticalDays) {
+				when = aurora.Yellow(left)
+			}
+			fmt.Printf("- %s %s, support ends %s (%s, within %d days)\n",
+				e.PoX.poxType,
+				e.PoX,
+				e.EndDate.Format(maintenanceDateFormat),
+				when,
+				e.Horizon,
+			)
+		}
+	}
+
+	if r.CountExpired() > 0 {
+		fmt.Printf("\n%s\n", aurora.Bold(fmt.Sprintf("Support ended within the last %d days", r.maxHorizon())))
+	}
+	for _, group := range r.Expired {
+		fmt.Printf("\n%s - %s:\n", aurora.Bold(companyName(group.Company)), group.ProductName)
+		for _, e := range group.Expiries {
+			fmt.Printf("- %s %s, support ended %s (%s)\n",
+				e.PoX.poxType,
+				e.PoX,
+				e.EndDate.Format(maintenanceDateFormat),
+				aurora.Gray(12, fmt.Sprintf("%d days ago", -e.DaysLeft)),
+			)
+		}
+	}
+
+	fmt.Printf("\n%d PoS/PoL support ending within %d days, %d within the critical window of %d days, %d ended\n",
+		r.Count(), r.maxHorizon(), len(r.Critical()), r.CriticalDays, r.CountExpired())
+}
+
+func companyName(company string) string {
+	if company == "" {
+		return "Unknown company"
+	}
+	return company
+}
+
+func (r *ExpiryReport) maxHorizon() int {
+	if len(r.Horizons) == 0 {
+		return 0
+	}
+	return r.Horizons[len(r.Horizons)-1]
+}
+
+func (e Expiry) MarshalJSON() ([]byte, error) {
+	type plainExpiry Expiry
+	return json.Marshal(struct {
+		PoX     string  `json:"pox"`
+		Type    PoXType `json:"type"`
+		EndDate string  `json:"support_end_date"`
+		plainExpiry
+	}{
+		PoX:         e.PoX.pox,
+		Type:        e.PoX.poxType,
+		EndDate:     e.EndDate.Format(maintenanceDateFormat),
+		plainExpiry: plainExpiry(e),
+	})
+}
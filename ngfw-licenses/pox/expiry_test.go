@@ -0,0 +1,99 @@
+package pox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+func TestPoX_MaintenanceEndTime(t *testing.T) {
+	tests := []struct {
+		status  statutes.SupportStatus
+		endDate string
+		want    time.Time
+		wantOk  bool
+	}{
+		{statutes.Activated, "2023-12-22", time.Date(2023, 12, 22, 0, 0, 0, 0, time.UTC), true},
+		{statutes.Expired, " 2020-01-31 ", time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), true},
+		{statutes.Spare, "Spare", time.Time{}, false},
+		{"", "", time.Time{}, false},
+		{statutes.Activated, "22/12/2023", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endDate, func(t *testing.T) {
+			pox := PoX{MaintenanceStatus: tt.status, MaintenanceEndDate: tt.endDate}
+			got, ok := pox.MaintenanceEndTime()
+			if ok != tt.wantOk || !got.Equal(tt.want) {
+				t.Errorf("MaintenanceEndTime() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestPoXList_Expiring(t *testing.T) {
+	now := time.Date(2021, 4, 12, 15, 30, 0, 0, time.Local)
+	newExpiring := func(id, company, product, endDate string) *PoX {
+		pox := mustNewPoS(id)
+		pox.Company, pox.ProductName = company, product
+		pox.MaintenanceStatus, pox.MaintenanceEndDate = statutes.Activated, endDate
+		return pox
+	}
+
+	poxList := PoXList{
+		newExpiring("0000000001-0000000001", "B Corp", "NGFW 120W", "2021-04-22"), // 10 days
+		newExpiring("0000000002-0000000002", "A Corp", "NGFW 2101", "2021-06-01"), // 50 days
+		newExpiring("0000000003-0000000003", "A Corp", "NGFW 120W", "2021-07-01"), // 80 days
+		newExpiring("0000000004-0000000004", "A Corp", "NGFW 120W", "2021-04-01"), // ended
+		newExpiring("0000000005-0000000005", "A Corp", "NGFW 120W", "2022-04-01"), // out of horizons
+		newExpiring("0000000006-0000000006", "A Corp", "NGFW 120W", "Spare"),
+		newExpiring("0000000007-0000000007", "B Corp", "NGFW 120W", "2020-04-12"), // ended a year ago
+	}
+	poxList[5].MaintenanceStatus = statutes.Spare
+
+	report := poxList.Expiring(now, []int{90, 30, 60}, 30)
+
+	type expiry struct {
+		pox      string
+		daysLeft int
+		horizon  int
+	}
+	want := []struct {
+		company, product string
+		expiries         []expiry
+	}{
+		{"A Corp", "NGFW 120W", []expiry{{"0000000003-0000000003", 80, 90}}},
+		{"A Corp", "NGFW 2101", []expiry{{"0000000002-0000000002", 50, 60}}},
+		{"B Corp", "NGFW 120W", []expiry{{"0000000001-0000000001", 10, 30}}},
+	}
+	if len(report.Groups) != len(want) {
+		t.Fatalf("%d groups, want %d: %+v", len(report.Groups), len(want), report.Groups)
+	}
+	for i, w := range want {
+		group := report.Groups[i]
+		if group.Company != w.company || group.ProductName != w.product || len(group.Expiries) != len(w.expiries) {
+			t.Errorf("group %d = %s/%s with %d expiries, want %s/%s with %d", i, group.Company, group.ProductName, len(group.Expiries), w.company, w.product, len(w.expiries))
+			continue
+		}
+		for j, we := range w.expiries {
+			e := group.Expiries[j]
+			if e.PoX.pox != we.pox || e.DaysLeft != we.daysLeft || e.Horizon != we.horizon {
+				t.Errorf("%s: DaysLeft, Horizon = %d, %d, want %s %d, %d", e.PoX.pox, e.DaysLeft, e.Horizon, we.pox, we.daysLeft, we.horizon)
+			}
+		}
+	}
+
+	// supports already ended are apart, and never critical
+	if len(report.Expired) != 1 || len(report.Expired[0].Expiries) != 1 || report.Expired[0].Expiries[0].PoX.pox != "0000000004-0000000004" || report.Expired[0].Expiries[0].DaysLeft != -11 {
+		t.Errorf("Expired = %+v, want 0000000004-0000000004 only", report.Expired)
+	}
+	if got := len(report.Critical()); got != 1 {
+		t.Errorf("len(Critical()) = %d, want 1", got)
+	}
+	if got := report.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+	if got := report.CountExpired(); got != 1 {
+		t.Errorf("CountExpired() = %d, want 1", got)
+	}
+}
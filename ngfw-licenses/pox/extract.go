@@ -0,0 +1,211 @@
+package pox
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"strings"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/common"
+)
+
+//=================================================================
+// Extractors
+
+// maxExtractDepth bounds the nesting of archives and attachments
+const maxExtractDepth = 5
+
+var (
+	// maxZipEntrySize and maxZipTotalSize bound the uncompressed data read
+	// from each file of a zip archive, and from the whole archive. They bound
+	// the inflated PDF streams and the decoded email parts the same way.
+	maxZipEntrySize int64 = 64 << 20
+	maxZipTotalSize int64 = 256 << 20
+
+	errTooLarge = errors.New("too large")
+)
+
+var (
+	magicPDF = []byte("%PDF-")
+	magicZip = []byte("PK\x03\x04")
+	magicCFB = []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+)
+
+// extractText returns the text PoS/PoL are searched in: the text of PDF files,
+// the decoded parts and attachments of MIME emails, the text of .msg Outlook
+// emails, and the files of zip archives. Other files are returned as is.
+func extractText(name string, data []byte) []byte {
+	return extract(name, data, 0)
+}
+
+func extract(name string, data []byte, depth int) []byte {
+	if depth > maxExtractDepth {
+		return data
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	var res []byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, magicPDF):
+		res, err = pdfText(data)
+	case bytes.HasPrefix(data, magicCFB):
+		res, err = msgText(data, depth)
+	case bytes.HasPrefix(data, magicZip) && ext != ".jar" && ext != ".xlsx":
+		res, err = zipText(data, depth)
+	case ext == ".eml" || ext == ".mht" || looksLikeEmail(data):
+		res, err = emailText(data, depth)
+	default:
+		return data
+	}
+	if err != nil {
+		// the raw data may still hold some PoS/PoL
+		Logger.Warnf("unable to extract text from %s: %v", name, err)
+		return data
+	}
+	return res
+}
+
+// looksLikeEmail tells if data starts with email headers
+func looksLikeEmail(data []byte) bool {
+	head := strings.ToLower(string(data[:common.Min(len(data), 4096)]))
+	if !strings.Contains(head, "\nfrom:") && !strings.HasPrefix(head, "from:") {
+		return false
+	}
+	return strings.Contains(head, "mime-version:") || strings.Contains(head, "\nreceived:") || strings.HasPrefix(head, "received:")
+}
+
+// zipText returns the text of every file of a zip archive, the files over
+// maxZipEntrySize, or over maxZipTotalSize once added up, being skipped
+func zipText(data []byte, depth int) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	total := int64(0)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		// the size told by the archive may be wrong
+		content, err := readLimited(rc, total)
+		rc.Close()
+		if errors.Is(err, errTooLarge) {
+			Logger.Warnf("%s skipped: %v", f.Name, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(content))
+		buf.Write(extract(f.Name, content, depth+1))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// readLimited reads r up to maxZipEntrySize bytes, and up to maxZipTotalSize
+// once added to the total already read, an errTooLarge error past them. The
+// data read is returned along with the other errors.
+func readLimited(r io.Reader, total int64) ([]byte, error) {
+	limit := maxZipEntrySize
+	if left := maxZipTotalSize - total; left < limit {
+		limit = left
+	}
+	// one byte more than the limit tells the data over it
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return data, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: over %d bytes uncompressed", errTooLarge, limit)
+	}
+	return data, nil
+}
+
+// emailText returns the subject and the decoded parts of a MIME email,
+// attachments included
+func emailText(data []byte, depth int) ([]byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	buf.WriteString(subject + "\n")
+
+	err = mimePart(&buf, msg.Header, msg.Body, depth)
+	return buf.Bytes(), err
+}
+
+// header is the part of the MIME headers mimePart needs, mail.Header and
+// textproto.MIMEHeader both provide it
+type header interface {
+	Get(key string) string
+}
+
+// mimePart writes to buf the decoded text of a MIME part, walking multipart
+// parts and extracting attachments
+func mimePart(buf *bytes.Buffer, h header, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := mimePart(buf, part.Header, part, depth); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := readLimited(body, int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+
+	name := params["name"]
+	if _, dispositionParams, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && dispositionParams["filename"] != "" {
+		name = dispositionParams["filename"]
+	}
+	if mediaType == "message/rfc822" {
+		name = "attached.eml"
+	}
+	buf.Write(extract(name, content, depth+1))
+	buf.WriteByte('\n')
+	return nil
+}
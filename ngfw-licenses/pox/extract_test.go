@@ -0,0 +1,317 @@
+package pox
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// newPDF returns a PDF file whose single page content stream is compressed
+func newPDF(t *testing.T, content string) []byte {
+	t.Helper()
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write([]byte(content))
+	zw.Close()
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", stream.Len())
+	buf.Write(stream.Bytes())
+	buf.WriteString("\nendstream\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func newZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, _ := zw.Create(name)
+		w.Write(files[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newMSG returns a compound file holding streams, every stream being stored
+// in the mini stream
+func newMSG(t *testing.T, streams map[string][]byte) []byte {
+	t.Helper()
+	const sectorSize, miniSize = 512, 64
+	le := binary.LittleEndian
+
+	var sectors [][]byte
+	var fat []uint32
+	// addChain stores data in new sectors and returns the first one
+	addChain := func(data []byte) uint32 {
+		start := uint32(len(sectors))
+		for i := 0; i < len(data) || i == 0; i += sectorSize {
+			sector := make([]byte, sectorSize)
+			copy(sector, data[i:])
+			sectors = append(sectors, sector)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = cfbEndOfChain
+		return start
+	}
+	u32 := func(v uint32) []byte {
+		b := make([]byte, 4)
+		le.PutUint32(b, v)
+		return b
+	}
+
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var miniStream, miniFAT bytes.Buffer
+	starts := make(map[string]uint32)
+	for _, name := range names {
+		starts[name] = uint32(miniStream.Len() / miniSize)
+		n := (len(streams[name]) + miniSize - 1) / miniSize
+		for i := 0; i < n; i++ {
+			next := uint32(miniStream.Len()/miniSize + i + 1)
+			if i == n-1 {
+				next = cfbEndOfChain
+			}
+			miniFAT.Write(u32(next))
+		}
+		padded := make([]byte, n*miniSize)
+		copy(padded, streams[name])
+		miniStream.Write(padded)
+	}
+
+	entry := func(name string, kind byte, start uint32, size int) []byte {
+		e := make([]byte, cfbDirSize)
+		u := utf16.Encode([]rune(name + "\x00"))
+		for i, c := range u {
+			le.PutUint16(e[2*i:], c)
+		}
+		le.PutUint16(e[64:], uint16(2*len(u)))
+		e[66] = kind
+		copy(e[68:], u32(cfbFreeSect))
+		copy(e[72:], u32(cfbFreeSect))
+		copy(e[76:], u32(cfbFreeSect))
+		copy(e[116:], u32(start))
+		le.PutUint64(e[120:], uint64(size))
+		return e
+	}
+
+	rootStart := addChain(miniStream.Bytes())
+	miniFATStart := addChain(miniFAT.Bytes())
+	var dir bytes.Buffer
+	dir.Write(entry("Root Entry", cfbRoot, rootStart, miniStream.Len()))
+	for _, name := range names {
+		dir.Write(entry(name, cfbStream, starts[name], len(streams[name])))
+	}
+	dirStart := addChain(dir.Bytes())
+
+	// a single FAT sector, marked as such in itself
+	fatSector := uint32(len(sectors))
+	fat = append(fat, 0xFFFFFFFD)
+	var fatData bytes.Buffer
+	for i := 0; i < sectorSize/4; i++ {
+		if i < len(fat) {
+			fatData.Write(u32(fat[i]))
+		} else {
+			fatData.Write(u32(cfbFreeSect))
+		}
+	}
+	sectors = append(sectors, fatData.Bytes())
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, magicCFB)
+	le.PutUint16(header[0x18:], 0x3E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], 1)
+	le.PutUint32(header[0x30:], dirStart)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3C:], miniFATStart)
+	le.PutUint32(header[0x40:], 1)
+	le.PutUint32(header[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[0x4C+4*i:], cfbFreeSect)
+	}
+	le.PutUint32(header[0x4C:], fatSector)
+
+	res := bytes.NewBuffer(header)
+	for _, s := range sectors {
+		res.Write(s)
+	}
+	return res.Bytes()
+}
+
+func utf16LE(s string) []byte {
+	var buf bytes.Buffer
+	for _, c := range utf16.Encode([]rune(s)) {
+		binary.Write(&buf, binary.LittleEndian, c)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractText(t *testing.T) {
+	pdf := newPDF(t, "BT /F1 12 Tf 72 712 Td [(Proof of Serial: 01234) -120 (56789-abcdef0123)] TJ ET\n"+
+		"BT 72 690 Td <31313131312d32323232322d33333333332d3434343434> Tj ET\n"+
+		"BT 72 670 Td (Escaped \\(PoS\\) \\071999999999-9999999999) Tj ET\n")
+
+	email := "From: orders@forcepoint.com\r\n" +
+		"To: purchasing@corp.com\r\n" +
+		"Subject: =?UTF-8?B?T3JkZXIgMDEyMzQtNTY3ODktYWJjZGUtZjAxMjM=?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Your PoS: 2222222222-=\r\n3333333333\r\n" +
+		"--b1\r\n" +
+		"Content-Type: application/zip; name=\"licenses.zip\"\r\n" +
+		"Content-Disposition: attachment; filename=\"licenses.zip\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		wrap(base64.StdEncoding.EncodeToString(newZip(t, map[string][]byte{"order/invoice.pdf": pdf})), 76) +
+		"--b1--\r\n"
+
+	msg := newMSG(t, map[string][]byte{
+		"__substg1.0_0037001F": utf16LE("Order confirmation"),
+		"__substg1.0_1000001F": utf16LE("Your PoS: 4444444444-5555555555"),
+		"__substg1.0_10090102": []byte("compressed RTF"),
+		"__substg1.0_37010102": newZip(t, map[string][]byte{"pol.txt": []byte("PoL 66666-77777-88888-99999")}),
+	})
+
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"invoice.pdf", pdf, []string{"0123456789-abcdef0123", "11111-22222-33333-44444", "9999999999-9999999999"}},
+		{"order.eml", []byte(email), []string{"01234-56789-abcde-f0123", "2222222222-3333333333", "0123456789-abcdef0123", "11111-22222-33333-44444"}},
+		// emails are told by their headers
+		{"", []byte(email), []string{"01234-56789-abcde-f0123", "2222222222-3333333333"}},
+		{"order.msg", msg, []string{"4444444444-5555555555", "66666-77777-88888-99999"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(extractText(tt.name, tt.data))
+			for _, id := range tt.want {
+				if !strings.Contains(got, id) {
+					t.Errorf("extractText() misses %s", id)
+				}
+			}
+		})
+	}
+
+	// plain text is returned as is
+	if got := extractText("list.txt", []byte(testPoS1)); string(got) != testPoS1 {
+		t.Errorf("extractText(text) = %q", got)
+	}
+	// invalid files are returned as is
+	if got := extractText("broken.msg", append(magicCFB, []byte(testPoS1)...)); !bytes.Contains(got, []byte(testPoS1)) {
+		t.Errorf("extractText(broken) = %q", got)
+	}
+}
+
+func TestExtractText_ZipLimits(t *testing.T) {
+	previousEntry, previousTotal := maxZipEntrySize, maxZipTotalSize
+	t.Cleanup(func() { maxZipEntrySize, maxZipTotalSize = previousEntry, previousTotal })
+	maxZipEntrySize, maxZipTotalSize = 64, 100
+
+	pad := func(s string, n int) []byte { return []byte(s + strings.Repeat(" ", n-len(s))) }
+	data := newZip(t, map[string][]byte{
+		"a.txt": pad(testPoS1, 60),
+		"b.txt": pad(testPoS2, 200), // over maxZipEntrySize
+		"c.txt": pad(testPoS3, 60),  // over maxZipTotalSize with a.txt
+		"d.txt": pad(testPoL1, 30),
+	})
+
+	got := string(extractText("licenses.zip", data))
+	for id, want := range map[string]bool{testPoS1: true, testPoS2: false, testPoS3: false, testPoL1: true} {
+		if strings.Contains(got, id) != want {
+			t.Errorf("extractText() holds %s = %v, want %v", id, !want, want)
+		}
+	}
+}
+
+func TestExtractText_StreamLimits(t *testing.T) {
+	previousEntry, previousTotal := maxZipEntrySize, maxZipTotalSize
+	t.Cleanup(func() { maxZipEntrySize, maxZipTotalSize = previousEntry, previousTotal })
+	maxZipEntrySize, maxZipTotalSize = 64, 100
+
+	text := "BT 72 712 Td (" + testPoS1 + ") Tj ET\n"
+	if got, err := pdfText(newPDF(t, text)); err != nil || !bytes.Contains(got, []byte(testPoS1)) {
+		t.Errorf("pdfText() = %q, %v, want %s", got, err, testPoS1)
+	}
+	// a stream inflating over the limit
+	if _, err := pdfText(newPDF(t, text+strings.Repeat(" ", 200))); !errors.Is(err, errTooLarge) {
+		t.Errorf("pdfText() error = %v, want %v", err, errTooLarge)
+	}
+
+	email := func(content string) []byte {
+		return []byte("From: orders@forcepoint.com\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			wrap(base64.StdEncoding.EncodeToString([]byte(content)), 76))
+	}
+	if got, err := emailText(email("PoS "+testPoS1), 0); err != nil || !bytes.Contains(got, []byte(testPoS1)) {
+		t.Errorf("emailText() = %q, %v, want %s", got, err, testPoS1)
+	}
+	// a part decoded over the limit
+	if _, err := emailText(email("PoS "+testPoS1+strings.Repeat(" ", 200)), 0); !errors.Is(err, errTooLarge) {
+		t.Errorf("emailText() error = %v, want %v", err, errTooLarge)
+	}
+}
+
+func TestReadPoXFormArgs_Email(t *testing.T) {
+	newTestPortal(t)
+
+	ioutil.WriteFile("order.eml", []byte("From: orders@forcepoint.com\r\nSubject: Order\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n"+
+		base64.StdEncoding.EncodeToString([]byte("PoS "+testPoS1+"\n"))+"\r\n"), 0644)
+
+	poxList, err := ReadPoXFormArgs([]string{"order.eml"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+	if len(poxList) != 1 || poxList[0].pox != testPoS1 || poxList[0].Source != "order.eml" {
+		t.Errorf("ReadPoXFormArgs() = %v, want %s from order.eml", poxList, testPoS1)
+	}
+}
+
+// wrap splits s in lines of n characters
+func wrap(s string, n int) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i += n {
+		end := i + n
+		if end > len(s) {
+			end = len(s)
+		}
+		buf.WriteString(s[i:end] + "\r\n")
+	}
+	return buf.String()
+}
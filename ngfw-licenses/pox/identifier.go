@@ -0,0 +1,276 @@
+package pox
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// Identifiers
+
+var (
+	reNGFWPoL = regexp.MustCompile(`^[a-fA-F0-9]{5}-[a-fA-F0-9]{5}-[a-fA-F0-9]{5}-[a-fA-F0-9]{5}$`)
+	reNGFWPoS = regexp.MustCompile(`^[a-fA-F0-9]{10}-[a-fA-F0-9]{10}$`)
+
+	// reToken matches the words PoS/PoL are searched in: letters and digits,
+	// joined by dashes
+	reToken = regexp.MustCompile(`[0-9A-Za-z]+(?:-[0-9A-Za-z]+)*`)
+	// reSpacedPoL and reSpacedPoS match the PoS/PoL whose dashes are
+	// surrounded by blanks
+	reSpacedPoL = regexp.MustCompile(`\b[a-fA-F0-9]{5} *- *[a-fA-F0-9]{5} *- *[a-fA-F0-9]{5} *- *[a-fA-F0-9]{5}\b`)
+	reSpacedPoS = regexp.MustCompile(`\b[a-fA-F0-9]{10} *- *[a-fA-F0-9]{10}\b`)
+
+	// normalizer replaces the Unicode dashes and blanks by ASCII ones, and
+	// drops the invisible characters left by copy and paste
+	normalizer = strings.NewReplacer(
+		"\u2010", "-", "\u2011", "-", "\u2012", "-", "\u2013", "-", "\u2014", "-", "\u2015", "-",
+		"\u2212", "-", "\ufe58", "-", "\ufe63", "-", "\uff0d", "-",
+		"\u00a0", " ", "\u2007", " ", "\u202f", " ", "\t", " ",
+		"\u00ad", "", "\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "",
+	)
+
+	// confusables are the characters typed instead of a digit
+	confusables = strings.NewReplacer(
+		"O", "0", "o", "0",
+		"I", "1", "i", "1", "l", "1", "L", "1",
+		"Z", "2", "z", "2",
+		"S", "5", "s", "5",
+		"G", "6", "g", "9",
+	)
+)
+
+// normalize returns text with ASCII dashes and blanks, and without blanks
+// around the dashes of PoS/PoL
+func normalize(text string) string {
+	text = normalizer.Replace(text)
+	dropBlanks := func(s string) string { return strings.ReplaceAll(s, " ", "") }
+	text = reSpacedPoL.ReplaceAllStringFunc(text, dropBlanks)
+	return reSpacedPoS.ReplaceAllStringFunc(text, dropBlanks)
+}
+
+// identifierType returns the type of a PoS/PoL, an empty one when id is
+// neither a PoS nor a PoL. PoS/PoL carry no published checksum: only their
+// shape is checked, a mistyped hexadecimal digit is found by the portal only.
+func identifierType(id string) PoXType {
+	switch {
+	case reNGFWPoL.MatchString(id):
+		return PoL
+	case reNGFWPoS.MatchString(id):
+		return PoS
+	}
+	return ""
+}
+
+// scanLine returns the PoS/PoL of a line of text, and the words which look
+// almost like a PoS/PoL. Identifiers are lower-cased.
+func scanLine(line string) []Item {
+	res := make([]Item, 0)
+	for _, token := range reToken.FindAllString(normalize(line), -1) {
+		res = append(res, scanToken(token)...)
+	}
+	return res
+}
+
+// scanToken returns the PoS/PoL of a word, or the lint of the word when it
+// holds none. A PoS/PoL next to a hexadecimal group of the same width, which
+// may be part of a longer identifier, is linted instead: "fw-01-" before a PoS
+// is a prefix, another 10 characters group is not.
+func scanToken(token string) []Item {
+	res := make([]Item, 0)
+	groups := strings.Split(token, "-")
+	for i := 0; i < len(groups); {
+		n, t := matchGroups(groups[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+
+		id := strings.ToLower(strings.Join(groups[i:i+n], "-"))
+		width := len(groups[i])
+		longer := func(g string) bool { return len(g) == width && isHex(g) }
+		if (i > 0 && longer(groups[i-1])) || (i+n < len(groups) && longer(groups[i+n])) {
+			res = append(res, Item{Lint: &Lint{Text: token, Type: t, Problem: LintLonger, Suggestions: []string{id}}})
+		} else {
+			res = append(res, Item{ID: id, Type: t})
+		}
+		i += n
+	}
+
+	if len(res) == 0 {
+		if lint := lintToken(token); lint != nil {
+			res = append(res, Item{Lint: lint})
+		}
+	}
+	return res
+}
+
+// matchGroups tells if groups start with the groups of a PoS or a PoL,
+// returning their number and the type
+func matchGroups(groups []string) (int, PoXType) {
+	if len(groups) >= 4 && identifierType(strings.Join(groups[:4], "-")) == PoL {
+		return 4, PoL
+	}
+	if len(groups) >= 2 && identifierType(strings.Join(groups[:2], "-")) == PoS {
+		return 2, PoS
+	}
+	return 0, ""
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+//=================================================================
+// Lint
+
+// Problems of the words which look almost like a PoS/PoL
+const (
+	LintConfusable      = "letters typed instead of digits"
+	LintMissingDashes   = "missing dashes"
+	LintMisplacedDashes = "misplaced dashes"
+	LintMissingChar     = "missing character"
+	LintExtraChar       = "extra character"
+	LintLonger          = "part of a longer string"
+)
+
+// Lint is a word which looks almost like a PoS/PoL, Type being empty when it
+// may be a PoS as well as a PoL
+type Lint struct {
+	Text        string   `json:"text"`
+	Type        PoXType  `json:"type,omitempty"`
+	Problem     string   `json:"problem"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Source      string   `json:"source"`
+	Line        int      `json:"line,omitempty"`
+}
+
+// Lints are the words which look almost like a PoS/PoL
+type Lints []Lint
+
+// lintToken returns the Lint of a word which looks almost like a PoS/PoL, or
+// nil
+func lintToken(token string) *Lint {
+	problems := make([]string, 0)
+	mapped := confusables.Replace(token)
+	if mapped != token {
+		problems = append(problems, LintConfusable)
+	}
+	groups := strings.Split(mapped, "-")
+	for _, g := range groups {
+		if !isHex(g) {
+			return nil
+		}
+	}
+
+	if t := identifierType(mapped); t != "" {
+		return &Lint{Text: token, Type: t, Problem: LintConfusable, Suggestions: []string{strings.ToLower(mapped)}}
+	}
+
+	stripped := strings.ToLower(strings.Join(groups, ""))
+	switch {
+	case len(stripped) == 20:
+		lint := &Lint{Text: token}
+		pos := stripped[:10] + "-" + stripped[10:]
+		pol := stripped[:5] + "-" + stripped[5:10] + "-" + stripped[10:15] + "-" + stripped[15:]
+		switch len(groups) {
+		case 1:
+			problems = append(problems, LintMissingDashes)
+			lint.Suggestions = []string{pos, pol}
+		case 2:
+			problems = append(problems, LintMisplacedDashes)
+			lint.Type, lint.Suggestions = PoS, []string{pos}
+		case 4:
+			problems = append(problems, LintMisplacedDashes)
+			lint.Type, lint.Suggestions = PoL, []string{pol}
+		default:
+			problems = append(problems, LintMisplacedDashes)
+			lint.Suggestions = []string{pos, pol}
+		}
+		lint.Problem = strings.Join(problems, ", ")
+		return lint
+
+	case len(stripped) == 19 || len(stripped) == 21:
+		problem := LintMissingChar
+		if len(stripped) == 21 {
+			problem = LintExtraChar
+		}
+		// the groups must be those of a PoS or of a PoL, give or take a
+		// character
+		var t PoXType
+		switch {
+		case len(groups) == 2 && nearLengths(groups, 10):
+			t = PoS
+		case len(groups) == 4 && nearLengths(groups, 5):
+			t = PoL
+		default:
+			return nil
+		}
+		return &Lint{Text: token, Type: t, Problem: strings.Join(append(problems, problem), ", ")}
+	}
+	return nil
+}
+
+// nearLengths tells if every group has n characters, but one of them which
+// has n-1 or n+1
+func nearLengths(groups []string, n int) bool {
+	off := 0
+	for _, g := range groups {
+		switch len(g) {
+		case n:
+		case n - 1, n + 1:
+			off++
+		default:
+			return false
+		}
+	}
+	return off == 1
+}
+
+// Location returns where the word has been found: "file:line", or the Source
+// alone when its line is unknown
+func (l Lint) Location() string {
+	return location(l.Source, l.Line)
+}
+
+func (l Lint) String() string {
+	kind := "a PoS/PoL"
+	if l.Type != "" {
+		kind = "a " + string(l.Type)
+	}
+	res := fmt.Sprintf("%s: %q looks like %s, %s", l.Location(), l.Text, kind, l.Problem)
+	if len(l.Suggestions) > 0 {
+		res += fmt.Sprintf(", did you mean %s?", strings.Join(l.Suggestions, " or "))
+	}
+	return res
+}
+
+// Display displays the lints, with their suggestions
+func (lints Lints) Display() {
+	if len(lints) == 0 {
+		fmt.Printf("No string looks almost like a PoS/PoL\n")
+		return
+	}
+
+	fmt.Printf("Found %d strings which look almost like a PoS/PoL:\n", len(lints))
+	for _, l := range lints {
+		kind := "PoS/PoL"
+		if l.Type != "" {
+			kind = string(l.Type)
+		}
+		fmt.Printf("- %s %s %s (%s)\n", aurora.Gray(12, l.Location()), aurora.Yellow(l.Text), kind, l.Problem)
+		for _, s := range l.Suggestions {
+			fmt.Printf("    did you mean %s?\n", aurora.Green(s))
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package pox
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		want  []string
+		lints []string
+	}{
+		{"plain", "PoS: " + testPoS1 + ", PoL: " + testPoL1, []string{testPoS1, testPoL1}, nil},
+		{"upper case", strings.ToUpper(testPoS1), []string{testPoS1}, nil},
+		{"html", "<td>" + testPoS1 + "</td><td>" + testPoL1 + "</td>", []string{testPoS1, testPoL1}, nil},
+		{"unicode dashes", "0123456789\u2011abcdef0123 01234\u201356789\u2013abcde\u2013f0123", []string{testPoS1, testPoL1}, nil},
+		{"spaced dashes", "0123456789 - abcdef0123 | 01234 - 56789 - abcde - f0123", []string{testPoS1, testPoL1}, nil},
+		{"invisible characters", "\ufeff0123456789-abcdef\u200b0123", []string{testPoS1}, nil},
+		{"named engine", "fw-paris-" + testPoS1, []string{testPoS1}, nil},
+		{"longer hex string", "aaaa" + testPoS1 + "bbb 99" + testPoS2, nil, nil},
+		{"longer hex groups", testPoL1 + "-45678", nil, []string{testPoL1 + "-45678"}},
+		{"longer PoS", "0123456789-" + testPoS1, nil, []string{"0123456789-" + testPoS1}},
+		{"short hex prefix", "fw-01-" + testPoS1, []string{testPoS1}, nil},
+		{"hex word prefix", "cafe-" + testPoS1, []string{testPoS1}, nil},
+		{"short hex suffix", testPoL1 + "-2", []string{testPoL1}, nil},
+		{"hex suffix", testPoS1 + "-beef", []string{testPoS1}, nil},
+		{"confusables", "O123456789-abcdef0l23", nil, []string{"O123456789-abcdef0l23"}},
+		{"words", "Order confirmation 2021-04-12, 12 licenses", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids, lints []string
+			for _, item := range scanLine(tt.line) {
+				if item.Lint != nil {
+					lints = append(lints, item.Lint.Text)
+				} else {
+					ids = append(ids, item.ID)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("scanLine() = %q, want %q", ids, tt.want)
+			}
+			if !reflect.DeepEqual(lints, tt.lints) {
+				t.Errorf("scanLine() lints = %q, want %q", lints, tt.lints)
+			}
+		})
+	}
+}
+
+func TestLintToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  *Lint
+	}{
+		{"O123456789-abcdef0l23", &Lint{Type: PoS, Problem: LintConfusable, Suggestions: []string{testPoS1}}},
+		{"0I234-56789-abcde-fO123", &Lint{Type: PoL, Problem: LintConfusable, Suggestions: []string{testPoL1}}},
+		{"0123456789abcdef0123", &Lint{Problem: LintMissingDashes, Suggestions: []string{testPoS1, testPoL1}}},
+		{"012345678-9abcdef0123", &Lint{Type: PoS, Problem: LintMisplacedDashes, Suggestions: []string{testPoS1}}},
+		{"0123-456789-abcde-f0123", &Lint{Type: PoL, Problem: LintMisplacedDashes, Suggestions: []string{testPoL1}}},
+		{"O123456789abcdef0123", &Lint{Problem: LintConfusable + ", " + LintMissingDashes, Suggestions: []string{testPoS1, testPoL1}}},
+		{"0123456789-abcdef012", &Lint{Type: PoS, Problem: LintMissingChar}},
+		{"01234-567890-abcde-f0123", &Lint{Type: PoL, Problem: LintExtraChar}},
+		{"0123456789-abcdef", nil},
+		{"0123456789-abcdef0123456", nil},
+		{"01234567-abcdef012345", &Lint{Type: PoS, Problem: LintMisplacedDashes, Suggestions: []string{"01234567ab-cdef012345"}}},
+		{"Order-confirmation", nil},
+		{"deadbeef", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			got := lintToken(tt.token)
+			if tt.want != nil {
+				tt.want.Text = tt.token
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lintToken() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintArgs(t *testing.T) {
+	newTestPortal(t)
+	ioutil.WriteFile("purchases.txt", []byte(testPoS1+"\n"+"PoL O1234-56789-abcde-f0123\n"+"PoS 1111111111-222222222\n"), 0644)
+
+	lints, err := LintArgs([]string{"purchases.txt"}, false, false)
+	if err != nil {
+		t.Fatalf("LintArgs() error = %v", err)
+	}
+	if len(lints) != 2 {
+		t.Fatalf("LintArgs() = %v, want 2 lints", lints)
+	}
+	if lints[0].Location() != "purchases.txt:2" || !reflect.DeepEqual(lints[0].Suggestions, []string{"01234-56789-abcde-f0123"}) {
+		t.Errorf("lints[0] = %+v", lints[0])
+	}
+	if lints[1].Location() != "purchases.txt:3" || lints[1].Problem != LintMissingChar {
+		t.Errorf("lints[1] = %+v", lints[1])
+	}
+
+	// --pos-only skips the PoL lints
+	if lints, _ := LintArgs([]string{"purchases.txt"}, true, false); len(lints) != 1 {
+		t.Errorf("LintArgs(posOnly) = %v, want 1 lint", lints)
+	}
+
+	// lints are skipped by ReadPoXFormArgs
+	poxList, err := ReadPoXFormArgs([]string{"purchases.txt"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+	if len(poxList) != 1 || poxList[0].pox != testPoS1 {
+		t.Errorf("ReadPoXFormArgs() = %v, want %s", poxList, testPoS1)
+	}
+
+	// a mistyped PoS/PoL given on command-line is not a missing file
+	_, err = ReadPoXFormArgs([]string{"0123456789-abcdefO123"}, false, false)
+	if err == nil || !strings.Contains(err.Error(), "did you mean "+testPoS1) {
+		t.Errorf("ReadPoXFormArgs() error = %v, want a suggestion", err)
+	}
+}
@@ -0,0 +1,144 @@
+package pox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//=================================================================
+// Manifest
+
+// ManifestFile is the manifest of the license files downloaded, written in
+// licenses_output_dir
+const ManifestFile = "manifest.json"
+
+// ManifestEntry records a downloaded license file
+type ManifestEntry struct {
+	File       string    `json:"file"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	PoX        string    `json:"pox"`
+	LicenseID  string    `json:"license_id"`
+	Downloaded time.Time `json:"downloaded"`
+	// CheckError is why the license file could not be checked against its
+	// PoS/PoL, empty when it has been
+	CheckError string `json:"check_error,omitempty"`
+}
+
+// Manifest gathers the license files downloaded in a directory, by file name
+type Manifest struct {
+	dir     string
+	mu      sync.Mutex
+	changed bool
+	Files   map[string]*ManifestEntry
+}
+
+// ReadManifest reads the manifest of dir, a missing manifest gives an empty one
+func ReadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{dir: dir, Files: make(map[string]*ManifestEntry)}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", filepath.Join(dir, ManifestFile), err)
+	}
+	for _, e := range entries {
+		m.Files[e.File] = e
+	}
+	return m, nil
+}
+
+// Save writes the manifest, sorted by file name, when entries have been added
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.changed {
+		return nil
+	}
+
+	entries := make([]*ManifestEntry, 0, len(m.Files))
+	for _, e := range m.Files {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(m.dir, ManifestFile), data, 0644); err != nil {
+		return err
+	}
+	m.changed = false
+	return nil
+}
+
+// Get returns the entry of a license file
+func (m *Manifest) Get(file string) (*ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.Files[file]
+	return e, ok
+}
+
+// Unchanged tells if the license file of pox is present, with the size and
+// checksum recorded in the manifest
+func (m *Manifest) Unchanged(pox *PoX) bool {
+	e, ok := m.Get(pox.LicenseFile)
+	if !ok || !strings.EqualFold(e.PoX, pox.pox) {
+		return false
+	}
+	size, sum, err := checksum(filepath.Join(m.dir, pox.LicenseFile))
+	return err == nil && size == e.Size && sum == e.SHA256
+}
+
+// Add records the license file of pox, as found in the directory
+func (m *Manifest) Add(pox *PoX) error {
+	size, sum, err := checksum(filepath.Join(m.dir, pox.LicenseFile))
+	if err != nil {
+		return err
+	}
+
+	entry := &ManifestEntry{
+		File:       pox.LicenseFile,
+		Size:       size,
+		SHA256:     sum,
+		PoX:        pox.pox,
+		LicenseID:  pox.LicenseID,
+		Downloaded: time.Now(),
+	}
+	if pox.licenseFileCheck != nil {
+		entry.CheckError = pox.licenseFileCheck.Error()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files[pox.LicenseFile] = entry
+	m.changed = true
+	return nil
+}
+
+func checksum(filename string) (int64, string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, "", err
+	}
+	sum := sha256.Sum256(data)
+	return int64(len(data)), hex.EncodeToString(sum[:]), nil
+}
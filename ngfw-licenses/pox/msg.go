@@ -0,0 +1,223 @@
+package pox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+//=================================================================
+// Outlook .msg
+
+// .msg emails are Compound File Binary files, every email property, body and
+// attachment being a stream named __substg1.0_<property><type>
+const (
+	cfbEndOfChain  = 0xFFFFFFFE
+	cfbFreeSect    = 0xFFFFFFFF
+	cfbHeaderSize  = 512
+	cfbDirSize     = 128
+	cfbStream      = 2
+	cfbRoot        = 5
+	msgUnicodeType = "001F"
+	msgString8Type = "001E"
+	msgBinaryType  = "0102"
+)
+
+var errInvalidCFB = errors.New("invalid compound file")
+
+// cfbEntry is a directory entry of a compound file
+type cfbEntry struct {
+	name  string
+	kind  byte
+	start uint32
+	size  uint64
+}
+
+// cfb is a read-only compound file
+type cfb struct {
+	data       []byte
+	sectorSize int
+	miniSize   int
+	miniCutoff uint64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+}
+
+// msgText returns the text properties of a .msg email, the body and the
+// subject among them, and the text of its attachments
+func msgText(data []byte, depth int) ([]byte, error) {
+	f, err := openCFB(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range f.entries {
+		if e.kind != cfbStream || !strings.HasPrefix(e.name, "__substg1.0_") {
+			continue
+		}
+		content, err := f.stream(e)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasSuffix(e.name, msgUnicodeType):
+			buf.WriteString(decodeUTF16(content))
+		case strings.HasSuffix(e.name, msgString8Type):
+			buf.Write(content)
+		case strings.HasSuffix(e.name, msgBinaryType):
+			// attachments data, their type is told by their content
+			buf.Write(extract("", content, depth+1))
+		default:
+			continue
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func openCFB(data []byte) (*cfb, error) {
+	if len(data) < cfbHeaderSize || !bytes.HasPrefix(data, magicCFB) {
+		return nil, errInvalidCFB
+	}
+	le := binary.LittleEndian
+	sectorShift, miniShift := le.Uint16(data[0x1E:]), le.Uint16(data[0x20:])
+	if sectorShift < 7 || sectorShift > 16 || miniShift > sectorShift {
+		return nil, errInvalidCFB
+	}
+	f := &cfb{
+		data:       data,
+		sectorSize: 1 << sectorShift,
+		miniSize:   1 << miniShift,
+		miniCutoff: uint64(le.Uint32(data[0x38:])),
+	}
+
+	// the FAT sectors are listed by the header, and then by the DIFAT chain
+	fatSectors := make([]uint32, 0)
+	for i := 0; i < 109; i++ {
+		if s := le.Uint32(data[0x4C+4*i:]); s != cfbFreeSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	difat, count := le.Uint32(data[0x44:]), le.Uint32(data[0x48:])
+	for ; difat != cfbEndOfChain && difat != cfbFreeSect && count > 0; count-- {
+		sector, err := f.sector(difat)
+		if err != nil {
+			return nil, err
+		}
+		n := f.sectorSize/4 - 1
+		for i := 0; i < n; i++ {
+			if s := le.Uint32(sector[4*i:]); s != cfbFreeSect {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		difat = le.Uint32(sector[4*n:])
+	}
+	for _, s := range fatSectors {
+		sector, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < f.sectorSize; i += 4 {
+			f.fat = append(f.fat, le.Uint32(sector[i:]))
+		}
+	}
+
+	dir, err := f.chain(le.Uint32(data[0x30:]), 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+cfbDirSize <= len(dir); i += cfbDirSize {
+		raw := dir[i : i+cfbDirSize]
+		nameLen := int(le.Uint16(raw[64:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		f.entries = append(f.entries, cfbEntry{
+			name:  strings.TrimRight(decodeUTF16(raw[:nameLen]), "\x00"),
+			kind:  raw[66],
+			start: le.Uint32(raw[116:]),
+			size:  le.Uint64(raw[120:]) & 0xFFFFFFFF,
+		})
+	}
+	if len(f.entries) == 0 || f.entries[0].kind != cfbRoot {
+		return nil, errInvalidCFB
+	}
+
+	// streams smaller than miniCutoff are stored in the root entry stream
+	if f.miniStream, err = f.chain(f.entries[0].start, f.entries[0].size); err != nil {
+		return nil, err
+	}
+	miniFAT, err := f.chain(le.Uint32(data[0x3C:]), 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+4 <= len(miniFAT); i += 4 {
+		f.miniFAT = append(f.miniFAT, le.Uint32(miniFAT[i:]))
+	}
+
+	return f, nil
+}
+
+func (f *cfb) sector(s uint32) ([]byte, error) {
+	offset := (int(s) + 1) * f.sectorSize
+	if offset < cfbHeaderSize || offset+f.sectorSize > len(f.data) {
+		return nil, errInvalidCFB
+	}
+	return f.data[offset : offset+f.sectorSize], nil
+}
+
+// chain reads the sectors chained by the FAT from start, truncated to size
+// unless size is 0
+func (f *cfb) chain(start uint32, size uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	for s, n := start, 0; s != cfbEndOfChain && s != cfbFreeSect; n++ {
+		if int(s) >= len(f.fat) || n > len(f.fat) {
+			return nil, errInvalidCFB
+		}
+		sector, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(sector)
+		s = f.fat[s]
+	}
+	if size > 0 && size < uint64(buf.Len()) {
+		return buf.Bytes()[:size], nil
+	}
+	return buf.Bytes(), nil
+}
+
+// stream returns the content of a stream entry
+func (f *cfb) stream(e cfbEntry) ([]byte, error) {
+	if e.size >= f.miniCutoff {
+		return f.chain(e.start, e.size)
+	}
+
+	var buf bytes.Buffer
+	for s, n := e.start, 0; s != cfbEndOfChain && s != cfbFreeSect && uint64(buf.Len()) < e.size; n++ {
+		offset := int(s) * f.miniSize
+		if int(s) >= len(f.miniFAT) || n > len(f.miniFAT) || offset+f.miniSize > len(f.miniStream) {
+			return nil, errInvalidCFB
+		}
+		buf.Write(f.miniStream[offset : offset+f.miniSize])
+		s = f.miniFAT[s]
+	}
+	if uint64(buf.Len()) < e.size {
+		return nil, errInvalidCFB
+	}
+	return buf.Bytes()[:e.size], nil
+}
+
+// decodeUTF16 decodes little endian UTF-16 text
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
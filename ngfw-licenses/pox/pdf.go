@@ -0,0 +1,128 @@
+package pox
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"regexp"
+)
+
+//=================================================================
+// PDF
+
+var (
+	rePDFStream = regexp.MustCompile(`>>\s*stream\r?\n`)
+	// rePDFText matches the text showing operators: literal or hex string
+	// followed by Tj, ' or ", and arrays followed by TJ
+	rePDFText = regexp.MustCompile(`(?s)(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)\s*(?:Tj|'|")|\[((?:\\.|[^\\\]])*)\]\s*TJ`)
+	// rePDFString matches the literal and hex strings of a TJ array
+	rePDFString = regexp.MustCompile(`(?s)\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>`)
+)
+
+// pdfText returns the text shown by the content streams of a PDF file, Flate
+// compressed streams being inflated, followed by the PDF file itself. Only
+// simple font encodings are decoded, the text of fonts with custom encodings
+// (Identity-H...) is missed.
+func pdfText(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, loc := range rePDFStream.FindAllIndex(data, -1) {
+		// the stream dictionary starts after "<n> <generation> obj"
+		dict := data[:loc[0]]
+		if i := bytes.LastIndex(dict, []byte(" obj")); i >= 0 {
+			dict = dict[i:]
+		}
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// truncated streams are still worth reading, streams too large
+			// are not
+			content, err = readLimited(zr, int64(buf.Len()))
+			zr.Close()
+			if errors.Is(err, errTooLarge) {
+				return nil, err
+			}
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// other filters are images or fonts
+			continue
+		}
+
+		for _, m := range rePDFText.FindAllSubmatch(content, -1) {
+			if len(m[1]) > 0 {
+				buf.Write(pdfString(m[1]))
+			} else {
+				// kerning values between the strings of a TJ array are dropped
+				for _, s := range rePDFString.FindAll(m[2], -1) {
+					buf.Write(pdfString(s))
+				}
+			}
+			buf.WriteByte('\n')
+		}
+	}
+
+	// document info and other uncompressed objects are searched as well
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// pdfString decodes a literal (string) or a hex <string>
+func pdfString(s []byte) []byte {
+	if s[0] == '<' {
+		h := bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, s[1:len(s)-1])
+		if len(h)%2 == 1 {
+			h = append(h, '0')
+		}
+		res := make([]byte, hex.DecodedLen(len(h)))
+		n, _ := hex.Decode(res, h)
+		return res[:n]
+	}
+
+	s = s[1 : len(s)-1]
+	res := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			res = append(res, s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			res = append(res, '\n')
+		case 'r':
+			res = append(res, '\r')
+		case 't':
+			res = append(res, '\t')
+		case 'b', 'f':
+		case '\r', '\n':
+			// line continuation
+		default:
+			if s[i] >= '0' && s[i] <= '7' {
+				// octal character code, up to 3 digits
+				code, j := 0, i
+				for ; j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7'; j++ {
+					code = code*8 + int(s[j]-'0')
+				}
+				res = append(res, byte(code))
+				i = j - 1
+			} else {
+				res = append(res, s[i])
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,144 @@
+package pox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/common"
+)
+
+//=================================================================
+// Pipeline
+
+// operation is a bulk operation on a PoXList
+type operation struct {
+	action Action
+	// name is displayed with the progress
+	name string
+	// filter selects the PoS/PoL the operation applies to
+	filter func(pox *PoX) bool
+	// do runs the operation on a single PoS/PoL, and tells if it changed
+	do func(ctx context.Context, pox *PoX) (changed bool, err error)
+}
+
+// run applies op to the PoS/PoL selected by op.filter, using
+// cfg.ConcurrentWorkers workers. Cancelling ctx skips the PoS/PoL not yet
+// started, the others are completed and ErrInterrupted is returned.
+func (poxList PoXList) run(ctx context.Context, op operation) (*Report, error) {
+	start := time.Now()
+
+	selected := make(PoXList, 0)
+	for _, pox := range poxList {
+		if op.filter(pox) {
+			selected = append(selected, pox)
+		}
+	}
+
+	workCtx := common.Detach(ctx)
+	wgWorkers := sync.WaitGroup{}
+	toDo := make(chan *PoX)
+	done := make(chan Result)
+
+	nbWorkers := common.Min(cfg.ConcurrentWorkers, len(selected))
+	wgWorkers.Add(nbWorkers)
+	for i := 1; i <= nbWorkers; i++ {
+		go func(id int) {
+			count := 0
+			Logger.Debugf("Worker-%d started", id)
+			defer wgWorkers.Done()
+			for pox := range toDo {
+				Logger.Debugf("Worker-%d start %s %s", id, op.name, pox.pox)
+				res := Result{PoX: pox, Action: op.action, Before: pox.State()}
+				itemStart := time.Now()
+				res.Changed, res.Err = op.do(workCtx, pox)
+				res.Duration = time.Since(itemStart)
+				res.After = pox.State()
+				if res.Err != nil {
+					Logger.Errorf("%v", res.Err)
+				}
+				Logger.Debugf("Worker-%d finished %s, final status is %s", id, pox.pox, pox.Status)
+				done <- res
+				count++
+			}
+			Logger.Debugf("Worker-%d done, %d PoS/PoL processed", id, count)
+		}(i)
+	}
+
+	var skipped PoXList
+	go func() {
+		skipped = selected.feed(ctx, toDo)
+		wgWorkers.Wait()
+		close(done)
+	}()
+
+	results := waitWorkDone(op.name, len(selected), done)
+	processed := len(results)
+	for _, pox := range skipped {
+		results = append(results, Result{PoX: pox, Action: op.action, Before: pox.State(), After: pox.State(), Skipped: true})
+	}
+
+	report := &Report{
+		Action:   op.action,
+		Start:    start,
+		Duration: time.Since(start),
+		Results:  results,
+	}
+
+	Logger.Infof("%d PoS/PoL processed in %v\n", processed, report.Duration.Truncate(time.Millisecond))
+	return report, interrupted(ctx, len(skipped))
+}
+
+// feed sends the PoS/PoL to toDo until ctx is cancelled, and returns the ones
+// which have been skipped
+func (poxList PoXList) feed(ctx context.Context, toDo chan<- *PoX) (skipped PoXList) {
+	defer close(toDo)
+
+	skipped = make(PoXList, 0)
+	for _, pox := range poxList {
+		if ctx.Err() != nil {
+			skipped = append(skipped, pox)
+			continue
+		}
+
+		select {
+		case toDo <- pox:
+		case <-ctx.Done():
+			skipped = append(skipped, pox)
+		}
+	}
+
+	return skipped
+}
+
+// waitWorkDone collects the results and displays the progress
+func waitWorkDone(prefix string, total int, done <-chan Result) []Result {
+	res := make([]Result, 0, total)
+
+	Logger.Debugf("Waiter started")
+	for r := range done {
+		res = append(res, r)
+		if !cfg.Silent {
+			fmt.Printf("\r%s %d/%d", prefix, len(res), total)
+		}
+	}
+	if !cfg.Silent {
+		fmt.Printf("\r                                  \r")
+	}
+	bufStdout := bufio.NewWriter(os.Stdout)
+	bufStdout.Flush()
+	Logger.Debugf("Waiter done, %d PoS/PoL processed", len(res))
+
+	return res
+}
+
+// interrupted returns ErrInterrupted when ctx has been cancelled
+func interrupted(ctx context.Context, skipped int) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %d PoS/PoL skipped", ErrInterrupted, skipped)
+}
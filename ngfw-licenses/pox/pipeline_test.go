@@ -0,0 +1,76 @@
+package pox
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPoXList_run(t *testing.T) {
+	newTestPortal(t)
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoS(testPoS2), mustNewPoS(testPoS3), mustNewPoL(testPoL1)}
+	errFailed := errors.New("failed")
+
+	var calls int64
+	report, err := poxList.run(context.Background(), operation{
+		action: ActionRefresh,
+		name:   "Testing",
+		filter: func(pox *PoX) bool { return pox.poxType == PoS },
+		do: func(ctx context.Context, pox *PoX) (bool, error) {
+			atomic.AddInt64(&calls, 1)
+			if pox.pox == testPoS3 {
+				return false, errFailed
+			}
+			return true, nil
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if calls != 3 || len(report.Results) != 3 {
+		t.Errorf("%d calls and %d results, want 3 of each", calls, len(report.Results))
+	}
+	if got := len(report.Changed()); got != 2 {
+		t.Errorf("len(Changed()) = %d, want 2", got)
+	}
+	if got := len(report.Failed()); got != 1 {
+		t.Errorf("len(Failed()) = %d, want 1", got)
+	}
+	if report.Err() == nil {
+		t.Errorf("Err() = nil, want an error")
+	}
+	for _, r := range report.Results {
+		if r.Action != ActionRefresh {
+			t.Errorf("%s: Action = %q, want %q", r.PoX.pox, r.Action, ActionRefresh)
+		}
+		if (r.PoX.pox == testPoS3) != errors.Is(r.Err, errFailed) {
+			t.Errorf("%s: error = %v", r.PoX.pox, r.Err)
+		}
+	}
+}
+
+func TestPoXList_runInterrupted(t *testing.T) {
+	newTestPortal(t)
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoS(testPoS2)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := poxList.run(ctx, operation{
+		name:   "Testing",
+		filter: func(pox *PoX) bool { return true },
+		do: func(ctx context.Context, pox *PoX) (bool, error) {
+			t.Errorf("%s processed after cancellation", pox.pox)
+			return true, nil
+		},
+	})
+
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("run() error = %v, want %v", err, ErrInterrupted)
+	}
+	if got := len(report.Skipped()); got != 2 || len(report.Results) != 2 {
+		t.Errorf("%d skipped out of %d results, want 2 out of 2", got, len(report.Results))
+	}
+}
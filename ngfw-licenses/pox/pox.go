@@ -2,17 +2,20 @@ package pox
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"mime/multipart"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/common"
+	license_file "github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/license-file"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
 	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
-	"github.com/go-resty/resty/v2"
 	"github.com/logrusorgru/aurora"
-	"github.com/snwfdhmp/errlog"
 )
 
 //=================================================================
@@ -25,9 +28,14 @@ const (
 	PoS PoXType = "PoS"
 )
 
-type PoX struct {
-	httpClient *resty.Client
+var (
+	// registrationTimeout and pollInterval bound the wait for the portal to
+	// generate a license file or to apply a binding change
+	registrationTimeout = 2 * time.Minute
+	pollInterval        = 15 * time.Second
+)
 
+type PoX struct {
 	poxType            PoXType
 	pox                string
 	PoL                string                 `json:"pol,omitempty"`
@@ -47,32 +55,104 @@ type PoX struct {
 	IsSpare bool `json:"is_spare" pagser:"div[id=MSC_Content] caption:contains('Support & Maintenance')+thead+tbody tr th->contains('No Support & Maintenance')"`
 
 	Error string `json:"error,omitempty"`
+
+	// Source is the file, URL... the PoS/PoL has been read from, and Line its
+	// line there, 0 when unknown
+	Source string `json:"source,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	// Metadata are the other columns of the CSV/XLSX row the PoS/PoL has
+	// been read from: customer, site, engine name...
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// licenseFileCheck is why the last downloaded license file could not be
+	// checked, see Download
+	licenseFileCheck error
 }
 
-func NewPoL(pol string) *PoX {
+// NewPoL returns the PoL, lower-cased as read from files and command-line
+func NewPoL(pol string) (*PoX, error) {
+	pol = strings.ToLower(pol)
 	if !reNGFWPoL.MatchString(pol) {
-		Logger.Fatalf("%v is not a valid PoL", pol)
+		return nil, newError("new PoL", pol, ErrInvalidIdentifier, nil)
 	}
 	return &PoX{
-		httpClient: resty.New(),
-		poxType:    PoL,
-		pox:        pol,
-		PoL:        pol,
-		Status:     statutes.Unknown,
-	}
+		poxType: PoL,
+		pox:     pol,
+		PoL:     pol,
+		Status:  statutes.Unknown,
+	}, nil
 }
 
-func NewPoS(pos string) *PoX {
+// NewPoS returns the PoS, lower-cased as read from files and command-line
+func NewPoS(pos string) (*PoX, error) {
+	pos = strings.ToLower(pos)
 	if !reNGFWPoS.MatchString(pos) {
-		Logger.Fatalf("%v is not a valid PoS", pos)
+		return nil, newError("new PoS", pos, ErrInvalidIdentifier, nil)
 	}
 	return &PoX{
-		httpClient: resty.New(),
-		poxType:    PoS,
-		pox:        pos,
-		PoS:        pos,
-		Status:     statutes.Unknown,
+		poxType: PoS,
+		pox:     pos,
+		PoS:     pos,
+		Status:  statutes.Unknown,
+	}, nil
+}
+
+// UnmarshalJSON restores a PoX from its JSON form, as written by verify
+func (pox *PoX) UnmarshalJSON(data []byte) error {
+	type plainPoX PoX
+	if err := json.Unmarshal(data, (*plainPoX)(pox)); err != nil {
+		return err
+	}
+
+	pox.PoL, pox.PoS = strings.ToLower(pox.PoL), strings.ToLower(pox.PoS)
+	switch {
+	case pox.PoL != "":
+		pox.poxType, pox.pox = PoL, pox.PoL
+	case pox.PoS != "":
+		pox.poxType, pox.pox = PoS, pox.PoS
+	default:
+		return newError("unmarshal", "", ErrInvalidIdentifier, nil)
+	}
+
+	return nil
+}
+
+// Identifier returns the PoS or the PoL
+func (pox PoX) Identifier() string {
+	return pox.pox
+}
+
+func (pox PoX) Type() PoXType {
+	return pox.poxType
+}
+
+// Location returns where the PoS/PoL has been read from: "file:line", or the
+// Source alone when its line is unknown
+func (pox PoX) Location() string {
+	return location(pox.Source, pox.Line)
+}
+
+func location(source string, line int) string {
+	if line == 0 {
+		return source
 	}
+	return fmt.Sprintf("%s:%d", source, line)
+}
+
+// maintenanceDateFormat is the format of the support end dates on the portal
+const maintenanceDateFormat = "2006-01-02"
+
+// MaintenanceEndTime returns the support end date, in UTC, and false for spare
+// PoS/PoL or when the date is unknown
+func (pox PoX) MaintenanceEndTime() (time.Time, bool) {
+	if pox.MaintenanceStatus == statutes.Spare {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(maintenanceDateFormat, strings.TrimSpace(pox.MaintenanceEndDate))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
 }
 
 func (pox PoX) String() string {
@@ -88,6 +168,10 @@ func (pox PoX) DetailedString() string {
 		maintenanceEndDate = aurora.Yellow(pox.MaintenanceEndDate)
 	case statutes.Spare:
 		maintenanceEndDate = aurora.Blue(pox.MaintenanceEndDate)
+	default:
+		if end, ok := pox.MaintenanceEndTime(); ok && end.Before(time.Now()) {
+			maintenanceEndDate = aurora.Yellow(pox.MaintenanceEndDate)
+		}
 	}
 
 	res := ""
@@ -113,6 +197,9 @@ func (pox PoX) DetailedString() string {
 			aurora.Gray(12, pox.Company),
 		)
 	}
+	if len(pox.Metadata) > 0 {
+		res += " " + aurora.Gray(12, "{"+pox.metadataString()+"}").String()
+	}
 
 	return res
 }
@@ -125,55 +212,84 @@ func (pox PoX) DetailedError() string {
 	)
 }
 
-// RefreshStatus is in charge of transitionning from state New to [Valid|Invalid]
-func (pox *PoX) RefreshStatus(showErrors bool) {
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
-	w.Close()
+// Message displayed by the portal instead of the license page
+const msgNoLicenseFound = "No license found with the given identifier"
 
-	var body []byte
-	for {
-		resp, _ := pox.httpClient.R().
-			SetFormData(map[string]string{"licenseIdentification": pox.pox}).
-			Post("https://stonesoftlicenses.forcepoint.com/license/load.do")
-
-		body = resp.Body()
-		if strings.Contains(string(body), "No license found with the given identifier") {
-			pox.Status = statutes.Invalid
-			pox.Error = "No license found with the given identifier"
-			Logger.Infof("'No license found with the given identifier' for %s", pox)
-			return
-		}
-		if strings.Contains(string(body), "Permission denied") {
-			pox.Status = statutes.Invalid
-			pox.Error = "Permission denied"
-			Logger.Infof("'Permission denied' for %s", pox)
-			time.Sleep(10 * time.Second)
-			continue
-		}
+// RefreshStatus is in charge of transitionning from state New to [Valid|Invalid]
+func (pox *PoX) RefreshStatus(ctx context.Context, showErrors bool) error {
+	body, err := getPortal().Load(ctx, pox.pox)
+	if err != nil {
+		return pox.failPortal("load", err)
+	}
 
-		// pox.Status = statutes.Valid
-		pox.Error = ""
-		break
+	if msg := loadPageError(body); msg != "" {
+		pox.Status = statutes.Invalid
+		pox.Error = msg
+		Logger.Infof("'%s' for %s", msg, pox)
+		return nil
 	}
 
-	pox.refreshStatus(showErrors, body)
+	// pox.Status = statutes.Valid
+	pox.Error = ""
+
+	return pox.refreshStatus(showErrors, body)
 }
 
-func (pox *PoX) refreshStatus(showErrors bool, body []byte) {
+func (pox *PoX) refreshStatus(showErrors bool, body []byte) error {
 	Logger.Infof("refreshStatus call for %s %s", pox.poxType, pox.pox)
 
 	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-refresh.html", body)
-	err := common.NewPagser().Parse(pox, string(body))
-	//check error
-	if err != nil {
-		log.Fatal(err)
+	if err := pox.parse(body); err != nil {
+		return pox.fail(newError("load", pox.pox, ErrParse, err))
+	}
+
+	return nil
+}
+
+// fail records err in the PoX Error field and returns it
+func (pox *PoX) fail(err error) error {
+	pox.Error = err.Error()
+	return err
+}
+
+// failPortal records a failed portal call, the PoS/PoL is marked Unreachable
+// once the retry policy gave up
+func (pox *PoX) failPortal(op string, err error) error {
+	if errors.Is(err, portal.ErrRetriesExhausted) {
+		pox.Status = statutes.Unreachable
+	}
+	return pox.fail(newError(op, pox.pox, ErrPortalUnreachable, err))
+}
+
+// parse fills the PoX fields from a license page
+func (pox *PoX) parse(body []byte) error {
+	if err := common.NewPagser().Parse(pox, string(body)); err != nil {
+		return err
 	}
 
 	if pox.IsSpare {
 		pox.MaintenanceStatus = statutes.Spare
 		pox.MaintenanceEndDate = "Spare"
 	}
+
+	return nil
+}
+
+// loadPageError returns the message displayed by the portal when it does not
+// answer with a license page, or an empty string
+func loadPageError(body []byte) string {
+	if bytes.Contains(body, []byte(msgNoLicenseFound)) {
+		return msgNoLicenseFound
+	}
+	return ""
+}
+
+// mayBeSubmitted tells if a form submission failed after reaching the portal,
+// without an answer telling whether it has been processed: the status has to
+// be checked again rather than the form submitted twice
+func mayBeSubmitted(err error) bool {
+	var statusErr *portal.StatusError
+	return !portal.NotSent(err) && !errors.As(err, &statusErr) && !errors.Is(err, portal.ErrPermissionDenied)
 }
 
 func (pox *PoX) getFormData() map[string]string {
@@ -196,84 +312,157 @@ func (pox *PoX) getFormData() map[string]string {
 }
 
 // Register is in charge to register the PoS using contactInfo and resseller
-func (pox *PoX) Register() {
+func (pox *PoX) Register(ctx context.Context) error {
 	if pox.poxType == PoL && pox.Status != statutes.Purchased {
 		Logger.Debugf("PoL Status has to been 'Purchased', current state is %v", pox.Status)
-		return
+		return nil
 	}
 
 	if pox.poxType == PoS && pox.Status != statutes.Purchased {
 		Logger.Debugf("PoS Status has to been 'Purchased', current state is %v", pox.Status)
-		return
+		return nil
 	}
 
-	// Send POST request
-	resp, _ := pox.httpClient.R().
-		SetFormData(pox.getFormData()).
-		Post("https://stonesoftlicenses.forcepoint.com/license/registerstonegate/save.do")
+	if cfg.ContactInfo == nil {
+		return newError("register", pox.pox, ErrMissingContactInfo, nil)
+	}
 
-	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-register.html", resp.Body())
+	body, err := getPortal().Register(ctx, pox.pox, pox.getFormData())
+	if err != nil {
+		// the form may have been processed, it must not be submitted twice
+		if mayBeSubmitted(err) && pox.RefreshStatus(ctx, false) == nil && pox.Status != statutes.Purchased {
+			Logger.Warnf("%s: registration failed (%v), but the portal shows it %v", pox.pox, err, pox.Status)
+			return nil
+		}
+		return pox.failPortal("register", err)
+	}
+
+	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-register.html", body)
+
+	return nil
 }
 
-func (pox *PoX) ChangeBinding() {
+func (pox *PoX) ChangeBinding(ctx context.Context) error {
 	if pox.poxType == PoS {
-		Logger.Debugf("Binding change on PoS is not supported. please open an issue if you need it.", pox.Status)
-		return
+		Logger.Debugf("Binding change on PoS is not supported. please open an issue if you need it.")
+		return nil
+	}
+
+	if cfg.ContactInfo == nil {
+		return newError("change-binding", pox.pox, ErrMissingContactInfo, nil)
 	}
 
-	resp, _ := pox.httpClient.R().
-		SetFormData(pox.getFormData()).
-		Post("https://stonesoftlicenses.forcepoint.com/license/changeaddress/save.do")
+	body, err := getPortal().ChangeAddress(ctx, pox.pox, pox.getFormData())
+	if err != nil {
+		if mayBeSubmitted(err) && pox.RefreshStatus(ctx, false) == nil && pox.Binding == cfg.Binding {
+			Logger.Warnf("%s: binding change failed (%v), but the portal shows it bound to %s", pox.pox, err, pox.Binding)
+			return nil
+		}
+		return pox.failPortal("change-binding", err)
+	}
 
-	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-changebinding.html", resp.Body())
+	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-changebinding.html", body)
+
+	return nil
 }
 
-func (pox *PoX) WaitForLicenseFileGeneration() {
-	maxEnd := time.Now().Add(time.Minute * 2)
+func (pox *PoX) WaitForLicenseFileGeneration(ctx context.Context) error {
+	maxEnd := time.Now().Add(registrationTimeout)
 	for {
-		pox.RefreshStatus(true)
+		if err := pox.RefreshStatus(ctx, true); err != nil {
+			return err
+		}
 
 		if pox.Status == statutes.Registered {
-			break
+			return nil
 		}
 
 		if time.Now().After(maxEnd) {
 			pox.Status = statutes.RegistrationError
-			Logger.Errorf("%s: there was a problem when registering this %s", pox.pox, pox.poxType)
-			break
+			return pox.fail(newError("register", pox.pox, ErrRegistrationTimeout, nil))
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return pox.fail(&Error{Op: "wait", PoX: pox.pox, Err: ctx.Err()})
 		}
-		time.Sleep(15 * time.Second)
 	}
 }
 
-func (pox *PoX) WaitForBindingChange() {
-	maxEnd := time.Now().Add(time.Minute * 2)
+func (pox *PoX) WaitForBindingChange(ctx context.Context) error {
+	maxEnd := time.Now().Add(registrationTimeout)
 	for {
-		pox.RefreshStatus(true)
+		if err := pox.RefreshStatus(ctx, true); err != nil {
+			return err
+		}
 
 		if pox.Binding == cfg.Binding {
-			break
+			return nil
 		}
 
 		if time.Now().After(maxEnd) {
 			pox.Status = statutes.RegistrationError
-			Logger.Errorf("%s: there was a problem when change-binding this %s", pox.pox, pox.poxType)
-			break
+			return pox.fail(newError("change-binding", pox.pox, ErrRegistrationTimeout, nil))
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return pox.fail(&Error{Op: "wait", PoX: pox.pox, Err: ctx.Err()})
 		}
-		time.Sleep(15 * time.Second)
 	}
 }
 
-func (pox *PoX) Download() bool {
+// checkLicenseFileContent detects the empty files and the HTML pages sent by
+// the portal instead of a license file
+func checkLicenseFileContent(body []byte) error {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ErrEmptyLicenseFile
+	}
+	start := strings.ToLower(string(trimmed[:common.Min(len(trimmed), 512)]))
+	if strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html") || strings.Contains(start, "<body") {
+		return ErrHTMLLicenseFile
+	}
+	return nil
+}
+
+// CheckLicenseFile returns an error when the license file is not the one of
+// the PoS/PoL
+func (pox *PoX) CheckLicenseFile(lf *license_file.LicenseFile) error {
+	return lf.Check(license_file.Expected{LicenseID: pox.LicenseID, Binding: pox.Binding})
+}
+
+func (pox *PoX) Download(ctx context.Context) error {
 	// Get the data
-	resp, err := pox.httpClient.R().
-		SetOutput(cfg.LicensesOutputDir + "/" + pox.LicenseFile).
-		Get("https://stonesoftlicenses.forcepoint.com/license/licensefile.do?file=" + pox.LicenseFile)
-	if errlog.Debug(err) {
-		Logger.Errorf("%s: %v", pox.pox, err)
+	body, err := getPortal().LicenseFile(ctx, pox.pox, pox.LicenseFile)
+	if err != nil {
+		return pox.failPortal("download", err)
+	}
+
+	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-download.html", body)
+
+	// the portal error pages are not license files
+	if err := checkLicenseFileContent(body); err != nil {
+		return pox.fail(&Error{Op: "download", PoX: pox.pox, Err: err})
+	}
+
+	// the layout of license files is not documented: a file which does not
+	// look like the one of this PoS/PoL is kept, and flagged in the manifest
+	lf, err := license_file.Parse(body)
+	if err == nil {
+		err = pox.CheckLicenseFile(lf)
+	}
+	pox.licenseFileCheck = err
+	if err != nil {
+		Logger.Warnf("%s: license file %s kept, but it could not be checked: %v", pox.pox, pox.LicenseFile, err)
 	}
 
-	common.Dump("dumps/"+pox.pox+"/"+time.Now().Format("20060102-150405")+"-download.html", resp.Body())
+	err = ioutil.WriteFile(filepath.Join(cfg.LicensesOutputDir, pox.LicenseFile), body, 0644)
+	if err != nil {
+		return pox.fail(&Error{Op: "download", PoX: pox.pox, Err: err})
+	}
 
-	return true
+	return nil
 }
@@ -0,0 +1,208 @@
+package pox
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+func TestNewPoX(t *testing.T) {
+	tests := []struct {
+		name    string
+		new     func(string) (*PoX, error)
+		arg     string
+		wantErr error
+	}{
+		{"PoS", NewPoS, testPoS1, nil},
+		{"PoL", NewPoL, testPoL1, nil},
+		{"upper case PoS", NewPoS, strings.ToUpper(testPoS1), nil},
+		{"upper case PoL", NewPoL, strings.ToUpper(testPoL1), nil},
+		{"PoL given as PoS", NewPoS, testPoL1, ErrInvalidIdentifier},
+		{"PoS given as PoL", NewPoL, testPoS1, ErrInvalidIdentifier},
+		{"garbage", NewPoS, "not-a-pos", ErrInvalidIdentifier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.new(tt.arg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			// PoS/PoL are compared as read from files, lower-cased
+			if err == nil && p.Identifier() != strings.ToLower(tt.arg) {
+				t.Errorf("Identifier() = %s, want %s", p.Identifier(), strings.ToLower(tt.arg))
+			}
+		})
+	}
+}
+
+// TestPoX_parse parses the hand-written pages of testdata/load, see
+// testdata/README: they are not dumps of the real portal pages
+func TestPoX_parse(t *testing.T) {
+	tests := []struct {
+		file string
+		pox  *PoX
+		want PoX
+	}{
+		{"pos-purchased.html", mustNewPoS(testPoS1), PoX{
+			Status:             statutes.Purchased,
+			LicenseID:          "700001",
+			ProductName:        "Forcepoint NGFW 120W Appliance",
+			Platform:           "Appliance",
+			MaintenanceStatus:  statutes.Activated,
+			MaintenanceEndDate: "2023-12-22",
+			SerialNumber:       "N0C100000001",
+		}},
+		{"pos-registered.html", mustNewPoS(testPoS1), PoX{
+			Status:             statutes.Registered,
+			LicenseID:          "700002",
+			ProductName:        "Forcepoint NGFW 1105 Appliance",
+			Binding:            "0a1b2c3d4e-5f6a7b8c9d",
+			Platform:           "Appliance",
+			LicenseFile:        "700002-20210412093512.jar",
+			MaintenanceStatus:  statutes.Activated,
+			MaintenanceEndDate: "2024-03-31",
+			SerialNumber:       "N0C100000002",
+			Company:            "ACME Corp",
+		}},
+		{"pol-registered.html", mustNewPoL(testPoL1), PoX{
+			Status:             statutes.Registered,
+			LicenseID:          "700003",
+			ProductName:        "Forcepoint NGFW Virtual Appliance",
+			Binding:            "192.0.2.10",
+			Platform:           "Linux",
+			LicensePeriod:      "Permanent",
+			LicenseFile:        "700003-20210412094001.jar",
+			MaintenanceStatus:  statutes.Activated,
+			MaintenanceEndDate: "2024-03-31",
+			Company:            "ACME Corp",
+		}},
+		{"pos-spare.html", mustNewPoS(testPoS1), PoX{
+			Status:             statutes.Registered,
+			LicenseID:          "700004",
+			ProductName:        "Forcepoint NGFW 2101 Appliance",
+			Binding:            "1a2b3c4d5e-6f7a8b9c0d",
+			Platform:           "Appliance",
+			LicenseFile:        "700004-20200110120000.jar",
+			MaintenanceStatus:  statutes.Spare,
+			MaintenanceEndDate: "Spare",
+			SerialNumber:       "N0C100000004",
+			Company:            "ACME Corp",
+			IsSpare:            true,
+		}},
+		{"pos-expired.html", mustNewPoS(testPoS1), PoX{
+			Status:             statutes.Registered,
+			LicenseID:          "700005",
+			ProductName:        "Forcepoint NGFW 120W Appliance",
+			Binding:            "2a3b4c5d6e-7f8a9b0c1d",
+			Platform:           "Appliance",
+			LicenseFile:        "700005-20180301080000.jar",
+			MaintenanceStatus:  statutes.Expired,
+			MaintenanceEndDate: "2021-02-28",
+			SerialNumber:       "N0C100000005",
+			Company:            "ACME Corp",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body := readTestdata(t, "load", tt.file)
+			if msg := loadPageError(body); msg != "" {
+				t.Fatalf("loadPageError() = %q, want none", msg)
+			}
+
+			got := tt.pox
+			if err := got.parse(body); err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+
+			fields := []struct {
+				name      string
+				got, want interface{}
+			}{
+				{"Status", got.Status, tt.want.Status},
+				{"LicenseID", got.LicenseID, tt.want.LicenseID},
+				{"ProductName", got.ProductName, tt.want.ProductName},
+				{"Binding", got.Binding, tt.want.Binding},
+				{"Platform", got.Platform, tt.want.Platform},
+				{"LicensePeriod", got.LicensePeriod, tt.want.LicensePeriod},
+				{"LicenseFile", got.LicenseFile, tt.want.LicenseFile},
+				{"MaintenanceStatus", got.MaintenanceStatus, tt.want.MaintenanceStatus},
+				{"MaintenanceEndDate", got.MaintenanceEndDate, tt.want.MaintenanceEndDate},
+				{"SerialNumber", got.SerialNumber, tt.want.SerialNumber},
+				{"Company", got.Company, tt.want.Company},
+				{"IsSpare", got.IsSpare, tt.want.IsSpare},
+			}
+			for _, f := range fields {
+				if f.got != f.want {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_loadPageError(t *testing.T) {
+	tests := []struct {
+		file                 string
+		want                 string
+		wantPermissionDenied bool
+	}{
+		{"invalid.html", msgNoLicenseFound, false},
+		{"permission-denied.html", "", true},
+		{"pos-purchased.html", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body := readTestdata(t, "load", tt.file)
+			if got := loadPageError(body); got != tt.want {
+				t.Errorf("loadPageError() = %q, want %q", got, tt.want)
+			}
+			if got := portal.IsPermissionDenied(body); got != tt.wantPermissionDenied {
+				t.Errorf("portal.IsPermissionDenied() = %v, want %v", got, tt.wantPermissionDenied)
+			}
+		})
+	}
+}
+
+func readTestdata(t *testing.T, elem ...string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(append([]string{testdataDir}, elem...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPoX_UnmarshalJSON(t *testing.T) {
+	for _, p := range []*PoX{mustNewPoS(testPoS1), mustNewPoL(testPoL1)} {
+		p.Status = statutes.Registered
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got PoX
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if got.Identifier() != p.Identifier() || got.Type() != p.Type() || got.Status != p.Status {
+			t.Errorf("got %s %s %s, want %s %s %s", got.Type(), got.Identifier(), got.Status, p.Type(), p.Identifier(), p.Status)
+		}
+	}
+
+	var upper PoX
+	if err := json.Unmarshal([]byte(`{"pos":"`+strings.ToUpper(testPoS1)+`"}`), &upper); err != nil || upper.Identifier() != testPoS1 {
+		t.Errorf("json.Unmarshal() = %s, %v, want %s", upper.Identifier(), err, testPoS1)
+	}
+
+	var got PoX
+	if err := json.Unmarshal([]byte(`{"licence_status":"REGISTERED"}`), &got); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("json.Unmarshal() error = %v, want %v", err, ErrInvalidIdentifier)
+	}
+}
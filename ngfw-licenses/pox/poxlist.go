@@ -1,18 +1,14 @@
 package pox
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"regexp"
 	"strings"
 	"sync"
-	"sync/atomic"
-	"time"
 
 	"github.com/Newlode/forcepoint-ngfw-licenses/config"
-	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/common"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
 	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
 	"github.com/mbndr/logo"
 	"github.com/snwfdhmp/errlog"
@@ -21,257 +17,178 @@ import (
 var (
 	cfg    = &config.Cfg
 	Logger *logo.Logger
+
+	// Portal is the license portal every PoS/PoL talks to, it defaults to an
+	// HTTPPortal using the portal_url, retry and rate_limit from config file
+	Portal            portal.LicensePortal
+	defaultPortalOnce sync.Once
 )
 
+func getPortal() portal.LicensePortal {
+	defaultPortalOnce.Do(func() {
+		if Portal == nil {
+			Portal = portal.NewPortal(cfg.PortalURL, cfg.Retry, cfg.RateLimit)
+		}
+	})
+	return Portal
+}
+
 //=================================================================
 // PoX List
 
 type PoXList []*PoX
 
-// RefreshStatus
-func (poxList PoXList) RefreshStatus() {
-	start := time.Now()
-	wgWorkers := sync.WaitGroup{}
-	wgWaiter := sync.WaitGroup{}
-	toDo := make(chan *PoX)
-	done := make(chan *PoX)
-
-	res := make(PoXList, 0)
-	go poxList.waitWorkDone(&wgWaiter, "Scanning", res, done)
-
-	nbWorkers := common.Min(cfg.ConcurrentWorkers, len(poxList))
-	wgWorkers.Add(nbWorkers)
-	for i := 1; i <= nbWorkers; i++ {
-		go func(id int) {
-			count := 0
-			Logger.Debugf("Worker-%d started", id)
-			defer wgWorkers.Done()
-			for pox := range toDo {
-				Logger.Debugf("Worker-%d start %s validation", id, pox.pox)
-				pox.RefreshStatus(true)
-				Logger.Debugf("Worker-%d finished %s, final status is %s", id, pox.pox, pox.Status)
-				done <- pox
-				count++
-			}
-			Logger.Debugf("Worker-%d done, %d PoS/PoL processed", id, count)
-		}(i)
-	}
-
-	for _, pox := range poxList {
-		toDo <- pox
-	}
-	close(toDo)
-
-	wgWorkers.Wait()
-	close(done)
-	wgWaiter.Wait()
-
-	Logger.Infof("%d PoS/PoL processed in %v\n", len(poxList), time.Since(start).Truncate(time.Millisecond))
+// RefreshStatus loads every PoS/PoL from the portal, failures are logged and
+// recorded in each PoX Error field.
+// Cancelling ctx is handled as by run.
+func (poxList PoXList) RefreshStatus(ctx context.Context) (*Report, error) {
+	return poxList.run(ctx, operation{
+		action: ActionRefresh,
+		name:   "Scanning",
+		filter: func(pox *PoX) bool { return true },
+		do: func(ctx context.Context, pox *PoX) (bool, error) {
+			currentStatus := pox.Status
+			err := pox.RefreshStatus(ctx, true)
+			return currentStatus != pox.Status, err
+		},
+	})
 }
 
-// Register
-func (poxList PoXList) Register() {
+// Register registers every Purchased PoS/PoL and waits for their license file,
+// failures are logged and recorded in each PoX Error field.
+// Cancelling ctx is handled as by run.
+func (poxList PoXList) Register(ctx context.Context) (*Report, error) {
 	if cfg.ContactInfo == nil {
-		Logger.Fatalf("Registrering PoS/PoL require contact informations from config file")
-	}
-	start := time.Now()
-	wgWorkers := sync.WaitGroup{}
-	wgWaiter := sync.WaitGroup{}
-	toDo := make(chan *PoX)
-	done := make(chan *PoX)
-	counter := int64(0)
-
-	res := make(PoXList, 0)
-	go poxList.waitWorkDone(&wgWaiter, "Registrering", res, done)
-
-	nbWorkers := common.Min(cfg.ConcurrentWorkers, len(poxList))
-	wgWorkers.Add(nbWorkers)
-	for i := 1; i <= nbWorkers; i++ {
-		go func(id int) {
-			count := 0
-			Logger.Debugf("Worker-%d started", id)
-			defer wgWorkers.Done()
-			for pox := range toDo {
-				currentStatus := pox.Status
-				pox.Register()
-				pox.WaitForLicenseFileGeneration()
-				done <- pox
-
-				if currentStatus != pox.Status {
-					Logger.Debugf("%s status changed from %v to %v", pox.pox, currentStatus, pox.Status)
-					count++
-					atomic.AddInt64(&counter, 1)
-				}
-			}
-			Logger.Debugf("Worker-%d done, %d PoS/PoL processed", id, count)
-		}(i)
-	}
-
-	for _, pox := range poxList {
-		// We want to register only Purchased PoS/PoL
-		Logger.Debugf("%+v", pox)
-		if pox.Status == statutes.Purchased {
-			Logger.Debugf("%s state is 'Purchased', trying to register", pox.pox)
-			toDo <- pox
-		}
+		return nil, ErrMissingContactInfo
 	}
-	close(toDo)
 
-	wgWorkers.Wait()
-	close(done)
-	wgWaiter.Wait()
+	report, err := poxList.run(ctx, operation{
+		action: ActionRegister,
+		name:   "Registrering",
+		filter: func(pox *PoX) bool {
+			// We want to register only Purchased PoS/PoL
+			Logger.Debugf("%+v", pox)
+			if pox.Status == statutes.Purchased {
+				Logger.Debugf("%s state is 'Purchased', trying to register", pox.pox)
+				return true
+			}
+			return false
+		},
+		do: func(ctx context.Context, pox *PoX) (bool, error) {
+			currentStatus := pox.Status
+			err := pox.Register(ctx)
+			if err == nil {
+				err = pox.WaitForLicenseFileGeneration(ctx)
+			}
+			if err != nil || currentStatus == pox.Status {
+				return false, err
+			}
+			Logger.Debugf("%s status changed from %v to %v", pox.pox, currentStatus, pox.Status)
+			return true, nil
+		},
+	})
 
 	if !cfg.Silent {
-		fmt.Printf("%d new PoS have been registred\n\n", counter)
+		fmt.Printf("%d new PoS have been registred\n\n", len(report.Changed()))
 	}
-	Logger.Infof("%d PoS/PoL processed in %v\n", len(poxList), time.Since(start).Truncate(time.Millisecond))
+	return report, err
 }
 
-// ChangeBinding
-func (poxList PoXList) ChangeBinding() {
+// ChangeBinding changes the binding of every Registered PoL to the one from
+// config file, failures are logged and recorded in each PoX Error field.
+// Cancelling ctx is handled as by run.
+func (poxList PoXList) ChangeBinding(ctx context.Context) (*Report, error) {
 	if cfg.ContactInfo == nil {
-		Logger.Fatalf("Change binding require contact informations from config file")
-	}
-	start := time.Now()
-	wgWorkers := sync.WaitGroup{}
-	wgWaiter := sync.WaitGroup{}
-	toDo := make(chan *PoX)
-	done := make(chan *PoX)
-	counter := int64(0)
-
-	res := make(PoXList, 0)
-	go poxList.waitWorkDone(&wgWaiter, "Change-binding", res, done)
-
-	nbWorkers := common.Min(cfg.ConcurrentWorkers, len(poxList))
-	wgWorkers.Add(nbWorkers)
-	for i := 1; i <= nbWorkers; i++ {
-		go func(id int) {
-			count := 0
-			Logger.Debugf("Worker-%d started", id)
-			defer wgWorkers.Done()
-			for pox := range toDo {
-				initialBinding := pox.Binding
-				pox.ChangeBinding()
-				pox.WaitForBindingChange()
-				done <- pox
-
-				if initialBinding != pox.Binding {
-					Logger.Debugf("%s binding changed from %v to %v", pox.pox, initialBinding, pox.Binding)
-					count++
-					atomic.AddInt64(&counter, 1)
-				}
-			}
-			Logger.Debugf("Worker-%d done, %d PoS/PoL processed", id, count)
-		}(i)
+		return nil, ErrMissingContactInfo
 	}
 
-	for _, pox := range poxList {
-		// We want to register only Purchased PoS/PoL
-		Logger.Debugf("%+v", pox)
-		if pox.poxType == PoL && pox.Status == statutes.Registered && pox.Binding != cfg.Binding {
-			Logger.Debugf("%s state is 'Registered', and Binding is different (%s -> %s), trying to register", pox.pox, pox.Binding, cfg.Binding)
-			toDo <- pox
-		}
-	}
-	close(toDo)
-
-	wgWorkers.Wait()
-	close(done)
-	wgWaiter.Wait()
+	report, err := poxList.run(ctx, operation{
+		action: ActionChangeBinding,
+		name:   "Change-binding",
+		filter: func(pox *PoX) bool {
+			// We want to change binding only of Registered PoL
+			Logger.Debugf("%+v", pox)
+			if pox.poxType == PoL && pox.Status == statutes.Registered && pox.Binding != cfg.Binding {
+				Logger.Debugf("%s state is 'Registered', and Binding is different (%s -> %s), trying to register", pox.pox, pox.Binding, cfg.Binding)
+				return true
+			}
+			return false
+		},
+		do: func(ctx context.Context, pox *PoX) (bool, error) {
+			initialBinding := pox.Binding
+			err := pox.ChangeBinding(ctx)
+			if err == nil {
+				err = pox.WaitForBindingChange(ctx)
+			}
+			if err != nil || initialBinding == pox.Binding {
+				return false, err
+			}
+			Logger.Debugf("%s binding changed from %v to %v", pox.pox, initialBinding, pox.Binding)
+			return true, nil
+		},
+	})
 
 	if !cfg.Silent {
-		fmt.Printf("%d binding have been changed\n\n", counter)
+		fmt.Printf("%d binding have been changed\n\n", len(report.Changed()))
 	}
-	Logger.Infof("%d PoS/PoL processed in %v\n", len(poxList), time.Since(start).Truncate(time.Millisecond))
+	return report, err
 }
 
-// Download
-func (poxList PoXList) Download() {
+// Download downloads the license file of every Registered PoS/PoL, failures
+// are logged and recorded in each PoX Error field.
+// Cancelling ctx is handled as by run.
+func (poxList PoXList) Download(ctx context.Context) (*Report, error) {
 	_, err := os.Stat(cfg.LicensesOutputDir)
 
 	if os.IsNotExist(err) {
 		err = os.Mkdir(cfg.LicensesOutputDir, os.ModePerm)
 		if errlog.Debug(err) {
-			Logger.Fatalf("Unable to create directory %s", cfg.LicensesOutputDir)
+			return nil, fmt.Errorf("unable to create directory %s: %w", cfg.LicensesOutputDir, err)
 		}
 	}
 
-	start := time.Now()
-	wgWorkers := sync.WaitGroup{}
-	wgWaiter := sync.WaitGroup{}
-	toDo := make(chan *PoX)
-	done := make(chan *PoX)
-	counter := int64(0)
-
-	res := make(PoXList, 0)
-	go poxList.waitWorkDone(&wgWaiter, "Downloading", res, done)
-
-	nbWorkers := common.Min(cfg.ConcurrentWorkers, len(poxList))
-	wgWorkers.Add(nbWorkers)
-	for i := 1; i <= nbWorkers; i++ {
-		go func(id int) {
-			count := 0
-			Logger.Debugf("Worker-%d started", id)
-			defer wgWorkers.Done()
-			for pox := range toDo {
-				if pox.Download() {
-					count++
-					atomic.AddInt64(&counter, 1)
-				}
-
-				done <- pox
-			}
-			Logger.Debugf("Worker-%d done, %d PoS/PoL processed", id, count)
-		}(i)
+	manifest, err := ReadManifest(cfg.LicensesOutputDir)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, pox := range poxList {
-		// We want to dopwnload only Registered PoS/PoL
-		if pox.Status != statutes.Registered {
-			continue
-		}
-
-		toDo <- pox
+	report, err := poxList.run(ctx, operation{
+		action: ActionDownload,
+		name:   "Downloading",
+		filter: func(pox *PoX) bool {
+			// We want to dopwnload only Registered PoS/PoL
+			return pox.Status == statutes.Registered
+		},
+		do: func(ctx context.Context, pox *PoX) (bool, error) {
+			// license files already downloaded are kept, unless changed since
+			if manifest.Unchanged(pox) {
+				Logger.Debugf("%s license file %s already downloaded", pox.pox, pox.LicenseFile)
+				return false, nil
+			}
+			if err := pox.Download(ctx); err != nil {
+				return false, err
+			}
+			if err := manifest.Add(pox); err != nil {
+				return false, pox.fail(&Error{Op: "download", PoX: pox.pox, Err: err})
+			}
+			return true, nil
+		},
+	})
+	if errManifest := manifest.Save(); errManifest != nil {
+		Logger.Errorf("unable to save manifest: %v", errManifest)
 	}
-	close(toDo)
-
-	wgWorkers.Wait()
-	close(done)
-	wgWaiter.Wait()
 
 	if !cfg.Silent {
-		fmt.Printf("%d license files have been downloaded in './%s/' directory\n", counter, cfg.LicensesOutputDir)
+		present := report.filter(func(res Result) bool { return !res.Changed && !res.Skipped && res.Err == nil })
+		fmt.Printf("%d license files have been downloaded in './%s/' directory, %d already present, %d failed\n",
+			len(report.Changed()), cfg.LicensesOutputDir, len(present), len(report.Failed()))
 	}
-	Logger.Infof("%d PoS/PoL processed in %v\n", len(poxList), time.Since(start).Truncate(time.Millisecond))
+	return report, err
 }
 
 //================================================================
 // Helpers
 
-func (poxList PoXList) waitWorkDone(wg *sync.WaitGroup, prefix string, res PoXList, done <-chan *PoX) {
-	var c = 0
-	defer func() {
-		wg.Done()
-		Logger.Debugf("Waiter done, %d PoS/PoL processed", c)
-	}()
-	wg.Add(1)
-
-	//! fmt.Println("")
-	Logger.Debugf("Waiter started")
-	for pox := range done {
-		res = append(res, pox)
-		c++
-		if !cfg.Silent {
-			fmt.Printf("\r%s %d/%d", prefix, len(res), len(poxList))
-		}
-	}
-	if !cfg.Silent {
-		fmt.Printf("\r                                  \r")
-	}
-	bufStdout := bufio.NewWriter(os.Stdout)
-	bufStdout.Flush()
-}
-
 func (poxList PoXList) CountByStatus(state statutes.LicenseStatus) (res int) {
 	for _, pox := range poxList {
 		if pox.Status == state {
@@ -352,99 +269,160 @@ func (poxList PoXList) Display() {
 //=================================================================
 // PoL/PoS List
 
-var (
-	reNGFWPoL = regexp.MustCompile(`[a-fA-F0-9]{5}-[a-fA-F0-9]{5}-[a-fA-F0-9]{5}-[a-fA-F0-9]{5}`)
-	reNGFWPoS = regexp.MustCompile(`[a-fA-F0-9]{10}-[a-fA-F0-9]{10}`)
-)
-
-// ReadPoXFormArgs
-func ReadPoXFormArgs(args []string, posOnly, polOnly bool) PoXList {
-	polList, posList := make([]string, 0), make([]string, 0)
+// sourceCount is the number of PoS/PoL read from a single source
+type sourceCount struct {
+	source   string
+	pol, pos int
+}
 
-	countPoLFromArgs, countPoSFromArgs := 0, 0
-	countPoLFromFiles, countPoSFromFiles, countFiles := 0, 0, 0
+// ReadPoXFormArgs reads PoS/PoL given on command-line, and from the files given
+// on command-line. Each argument is read by the first kind of Source opening
+// it, see RegisterSource: PoS/PoL, "-" for stdin, URLs, and then files and
+// directories, walked recursively keeping the files matching the include globs
+// and not the exclude ones from config file. Files are read by the first
+// Format matching them, see RegisterFormat, or as text, see extractText.
+// posOnly keeps the PoS only, polOnly the PoL only.
+func ReadPoXFormArgs(args []string, posOnly, polOnly bool) (PoXList, error) {
+	items, lints, sourceCounts, err := readItems(args, posOnly, polOnly)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, arg := range args {
-		// if arg is a PoL
-		if reNGFWPoL.MatchString(arg) {
-			// and if we want to read PoL
-			if !posOnly {
-				polList = append(polList, arg)
-				countPoLFromArgs++
-			}
-		} else if reNGFWPoS.MatchString(arg) {
-			// and if we want to read PoS
-			if !polOnly {
-				posList = append(posList, arg)
-				countPoSFromArgs++
-			}
-		} else {
-			// else, it should be a filename
-			data, err := ioutil.ReadFile(arg)
-			if err != nil {
-				Logger.Fatalf("%v", err)
-			}
-			var r []string
-			if !polOnly {
-				r = dedup(reNGFWPoL.FindAllString(string(data), -1))
-				polList = append(polList, r...)
-				countPoLFromFiles += len(r)
-			}
-			if !posOnly {
-				r = dedup(reNGFWPoS.FindAllString(string(data), -1))
-				posList = append(posList, r...)
-				countPoSFromFiles += len(r)
-			}
-			countFiles++
+	counts := make([]sourceCount, 0, len(sourceCounts))
+	fromArgs, fromFiles := sourceCount{}, sourceCount{}
+	for _, count := range sourceCounts {
+		if count.source == commandLineName {
+			fromArgs.pol += count.pol
+			fromArgs.pos += count.pos
+			continue
 		}
+		fromFiles.pol += count.pol
+		fromFiles.pos += count.pos
+		counts = append(counts, count)
 	}
 
 	Logger.Infof("%d PoL and %d PoS read, %d PoL and %d PoS from command-line, and %d PoL and %d PoS from %d files",
-		countPoLFromArgs+countPoLFromFiles, countPoSFromArgs+countPoSFromFiles,
-		countPoLFromArgs, countPoSFromArgs, countPoLFromFiles, countPoSFromFiles, countFiles)
+		fromArgs.pol+fromFiles.pol, fromArgs.pos+fromFiles.pos,
+		fromArgs.pol, fromArgs.pos, fromFiles.pol, fromFiles.pos, len(counts))
+	for _, count := range counts {
+		Logger.Debugf("%d PoL and %d PoS from %s", count.pol, count.pos, count.source)
+	}
 	if !cfg.Silent {
 		fmt.Printf("%d PoL and %d PoS read, %d PoL and %d PoS from command-line, and %d PoL and %d PoS from %d files\n",
-			countPoLFromArgs+countPoLFromFiles, countPoSFromArgs+countPoSFromFiles,
-			countPoLFromArgs, countPoSFromArgs, countPoLFromFiles, countPoSFromFiles, countFiles)
+			fromArgs.pol+fromFiles.pol, fromArgs.pos+fromFiles.pos,
+			fromArgs.pol, fromArgs.pos, fromFiles.pol, fromFiles.pos, len(counts))
+		if len(counts) > 1 {
+			for _, count := range counts {
+				fmt.Printf("- %s: %d PoL and %d PoS\n", count.source, count.pol, count.pos)
+			}
+		}
 	}
 
-	return append(createPoX(polList, NewPoL), createPoX(posList, NewPoS)...)
-}
-
-func dedup(list []string) (res []string) {
-	r := make(map[string]bool)
-	for _, s := range list {
-		r[s] = true
+	for _, lint := range lints {
+		Logger.Warnf("%s", lint)
 	}
-	for k := range r {
-		res = append(res, k)
+	if !cfg.Silent && len(lints) > 0 {
+		fmt.Printf("%d strings look almost like a PoS/PoL and have been skipped, see the lint command\n", len(lints))
 	}
-	return res
+
+	return createPoX(items)
 }
 
-func createPoX(list []string, fct func(string) *PoX) PoXList {
-	res := make(PoXList, 0)
-	dedupList := make([]string, 0)
-
-	for _, pox := range list {
-		// trying to get only unique PoS
-		present := false
-		for _, p := range dedupList {
-			if pox == p {
-				present = true
-				break
+// LintArgs returns the words which look almost like a PoS/PoL in the arguments
+// ReadPoXFormArgs reads, with suggested corrections
+func LintArgs(args []string, posOnly, polOnly bool) (Lints, error) {
+	_, lints, _, err := readItems(args, posOnly, polOnly)
+	return lints, err
+}
+
+// readItems returns the PoS/PoL read from args, following posOnly and polOnly,
+// the words which look almost like a PoS/PoL, and the number of PoS/PoL read
+// from each source
+func readItems(args []string, posOnly, polOnly bool) ([]Item, Lints, []sourceCount, error) {
+	items, lints := make([]Item, 0), make(Lints, 0)
+	counts := make([]sourceCount, 0)
+
+	for _, arg := range args {
+		sources, err := openSources(arg)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, source := range sources {
+			r, err := source.Items()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			count := sourceCount{source: source.Name()}
+			seen := make(map[string]bool)
+			for _, item := range r {
+				if item.Source == "" {
+					item.Source = source.Name()
+				}
+				t := item.Type
+				if item.Lint != nil {
+					t = item.Lint.Type
+				}
+				if (posOnly && t == PoL) || (polOnly && t == PoS) {
+					continue
+				}
+
+				if item.Lint != nil {
+					lint := *item.Lint
+					lint.Source, lint.Line = item.Source, item.Line
+					lints = append(lints, lint)
+					continue
+				}
+				items = append(items, item)
+				if seen[item.ID] {
+					continue
+				}
+				seen[item.ID] = true
+				if item.Type == PoL {
+					count.pol++
+				} else {
+					count.pos++
+				}
 			}
+			counts = append(counts, count)
 		}
+	}
+
+	return items, lints, counts, nil
+}
 
-		// allready here, skipping this one
-		if present {
+// createPoX returns the PoL and then the PoS of items, each of them once with
+// the source and the line it has first been read from, and the first metadata
+// found
+func createPoX(items []Item) (PoXList, error) {
+	pols, poss := make(PoXList, 0), make(PoXList, 0)
+	known := make(map[string]*PoX)
+
+	for _, item := range items {
+		if p, ok := known[item.ID]; ok {
+			if p.Metadata == nil {
+				p.Metadata = item.Metadata
+			}
 			continue
 		}
 
-		dedupList = append(dedupList, pox)
+		newPoX := NewPoS
+		if item.Type == PoL {
+			newPoX = NewPoL
+		}
+		p, err := newPoX(item.ID)
+		if err != nil {
+			return nil, err
+		}
+		p.Source, p.Line, p.Metadata = item.Source, item.Line, item.Metadata
+		known[item.ID] = p
 
-		res = append(res, fct(pox))
+		if item.Type == PoL {
+			pols = append(pols, p)
+		} else {
+			poss = append(poss, p)
+		}
 	}
 
-	return res
+	return append(pols, poss...), nil
 }
@@ -0,0 +1,571 @@
+package pox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	contact_info "github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/contact-info"
+	license_file "github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/license-file"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/portal/portaltest"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+const (
+	testPoS1 = "0123456789-abcdef0123"
+	testPoS2 = "1111111111-2222222222"
+	testPoL1 = "01234-56789-abcde-f0123"
+	testPoS3 = "9999999999-9999999999"
+)
+
+// testdataDir is the absolute path of testdata, tests running in a temporary directory
+var testdataDir string
+
+func TestMain(m *testing.M) {
+	Logger = config.GetNewLogger("POX   ")
+
+	testdataDir, _ = filepath.Abs("testdata")
+
+	// dumps are written in the working directory
+	dir, err := ioutil.TempDir("", "pox-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Chdir(dir)
+
+	pollInterval = 10 * time.Millisecond
+	registrationTimeout = time.Second
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func mustNewPoS(pos string) *PoX {
+	pox, err := NewPoS(pos)
+	if err != nil {
+		panic(err)
+	}
+	return pox
+}
+
+func mustNewPoL(pol string) *PoX {
+	pox, err := NewPoL(pol)
+	if err != nil {
+		panic(err)
+	}
+	return pox
+}
+
+// newTestPortal starts a fake portal and points the pox package to it
+func newTestPortal(t *testing.T) *portaltest.Server {
+	t.Helper()
+
+	srv := portaltest.NewServer()
+	t.Cleanup(srv.Close)
+
+	previous := Portal
+	Portal = portal.NewHTTPPortal(srv.URL)
+	t.Cleanup(func() { Portal = previous })
+
+	*cfg = config.Config{
+		Silent:            true,
+		ConcurrentWorkers: 4,
+		LicensesOutputDir: t.TempDir(),
+		Binding:           "192.168.1.1",
+		ContactInfo: &contact_info.ContactInfo{
+			Firstname: "Foo",
+			Lastname:  "Bar",
+			Email:     "foo.bar@corp.com",
+			Phone:     "+33612345678",
+			Company:   "My Corp",
+			Address:   "12 rue Portalis",
+			Zip:       "75008",
+			City:      "Paris",
+			Country:   "FR",
+			State:     "75",
+		},
+	}
+
+	return srv
+}
+
+func TestPoXList_RefreshStatus(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	srv.AddPoL(testPoL1)
+
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoL(testPoL1), mustNewPoS(testPoS3)}
+	poxList.RefreshStatus(context.Background())
+
+	tests := []struct {
+		name   string
+		pox    *PoX
+		status statutes.LicenseStatus
+	}{
+		{"purchased PoS", poxList[0], statutes.Purchased},
+		{"purchased PoL", poxList[1], statutes.Purchased},
+		{"unknown PoS", poxList[2], statutes.Invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.pox.Status != tt.status {
+				t.Errorf("Status = %v, want %v", tt.pox.Status, tt.status)
+			}
+		})
+	}
+
+	if got := poxList[0].SerialNumber; got != "N0C012345678" {
+		t.Errorf("SerialNumber = %q, want %q", got, "N0C012345678")
+	}
+}
+
+func TestPoXList_RefreshStatusUnreachable(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	srv.Close()
+
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoS(testPoS2)}
+	report, err := poxList.RefreshStatus(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshStatus() error = %v", err)
+	}
+	if got := len(report.Failed()); got != 2 {
+		t.Errorf("len(Failed()) = %d, want 2", got)
+	}
+
+	for _, pox := range poxList {
+		if pox.Status != statutes.Unknown || pox.Error == "" {
+			t.Errorf("%s: Status = %v, Error = %q, want %v with an error", pox.pox, pox.Status, pox.Error, statutes.Unknown)
+		}
+	}
+
+	err = poxList[0].RefreshStatus(context.Background(), true)
+	if !errors.Is(err, ErrPortalUnreachable) {
+		t.Errorf("PoX.RefreshStatus(context.Background()) error = %v, want %v", err, ErrPortalUnreachable)
+	}
+}
+
+func TestPoXList_RefreshStatusThrottled(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	srv.Throttle(100)
+	Portal = portal.WithRetry(Portal, portal.RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond})
+
+	poxList := PoXList{mustNewPoS(testPoS1)}
+	poxList.RefreshStatus(context.Background())
+
+	if got := poxList[0].Status; got != statutes.Unreachable {
+		t.Errorf("Status = %v, want %v", got, statutes.Unreachable)
+	}
+	if got := srv.Requests(portal.LoadPath); got != 2 {
+		t.Errorf("%d requests sent, want 2", got)
+	}
+}
+
+func TestPoXList_Register(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.RegistrationDelay = 50 * time.Millisecond
+	srv.AddPoS(testPoS1)
+	srv.AddPoS(testPoS2)
+	srv.AddPoL(testPoL1)
+
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoS(testPoS2), mustNewPoL(testPoL1)}
+	poxList.RefreshStatus(context.Background())
+	report, err := poxList.Register(context.Background())
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got := len(report.Changed()); got != 3 {
+		t.Errorf("len(Changed()) = %d, want 3", got)
+	}
+	for _, r := range report.Results {
+		if r.Before.Status != statutes.Purchased || r.After.Status != statutes.Registered {
+			t.Errorf("%s: %v -> %v, want %v -> %v", r.PoX.pox, r.Before.Status, r.After.Status, statutes.Purchased, statutes.Registered)
+		}
+	}
+
+	for _, pox := range poxList {
+		if pox.Status != statutes.Registered {
+			t.Errorf("%s: Status = %v, want %v", pox.pox, pox.Status, statutes.Registered)
+		}
+		if pox.Company != cfg.ContactInfo.Company {
+			t.Errorf("%s: Company = %q, want %q", pox.pox, pox.Company, cfg.ContactInfo.Company)
+		}
+		if pox.LicenseFile == "" {
+			t.Errorf("%s: LicenseFile is empty", pox.pox)
+		}
+	}
+	if got := poxList[2].Binding; got != cfg.Binding {
+		t.Errorf("PoL Binding = %q, want %q", got, cfg.Binding)
+	}
+	if got := srv.Requests(portal.RegisterPath); got != 3 {
+		t.Errorf("%d registrations sent, want 3", got)
+	}
+
+	// already registered PoS/PoL must not be submitted again
+	poxList.Register(context.Background())
+	if got := srv.Requests(portal.RegisterPath); got != 3 {
+		t.Errorf("%d registrations sent, want 3", got)
+	}
+}
+
+func TestPoXList_RegisterTimeout(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.RegistrationDelay = time.Hour
+	srv.AddPoS(testPoS1)
+
+	poxList := PoXList{mustNewPoS(testPoS1)}
+	poxList.RefreshStatus(context.Background())
+	poxList.Register(context.Background())
+
+	if got := poxList[0].Status; got != statutes.RegistrationError {
+		t.Errorf("Status = %v, want %v", got, statutes.RegistrationError)
+	}
+	if got := poxList[0].Error; got == "" {
+		t.Errorf("Error is empty, want a registration timeout")
+	}
+}
+
+// lostAnswerPortal submits the forms, but loses the portal answers
+type lostAnswerPortal struct {
+	portal.LicensePortal
+}
+
+func (p lostAnswerPortal) Register(ctx context.Context, pox string, form map[string]string) ([]byte, error) {
+	p.LicensePortal.Register(ctx, pox, form)
+	return nil, io.ErrUnexpectedEOF
+}
+
+func TestPoXList_RegisterLostAnswer(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	Portal = lostAnswerPortal{Portal}
+
+	poxList := PoXList{mustNewPoS(testPoS1)}
+	poxList.RefreshStatus(context.Background())
+	if _, err := poxList.Register(context.Background()); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	// the portal shows the PoS registered, the lost answer is not an error
+	if got := poxList[0].Status; got != statutes.Registered {
+		t.Errorf("Status = %v, want %v", got, statutes.Registered)
+	}
+	if got := srv.Requests(portal.RegisterPath); got != 1 {
+		t.Errorf("%d registrations sent, want 1", got)
+	}
+}
+
+func TestPoXList_RegisterWithoutContactInfo(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	cfg.ContactInfo = nil
+
+	poxList := PoXList{mustNewPoS(testPoS1)}
+	poxList.RefreshStatus(context.Background())
+
+	if _, err := poxList.Register(context.Background()); !errors.Is(err, ErrMissingContactInfo) {
+		t.Errorf("Register() error = %v, want %v", err, ErrMissingContactInfo)
+	}
+	if got := srv.Requests(portal.RegisterPath); got != 0 {
+		t.Errorf("%d registrations sent, want 0", got)
+	}
+}
+
+func TestPoXList_RegisterInterrupted(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.RegistrationDelay = 50 * time.Millisecond
+	srv.AddPoS(testPoS1)
+	srv.AddPoS(testPoS2)
+	srv.AddPoL(testPoL1)
+	cfg.ConcurrentWorkers = 1
+
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoS(testPoS2), mustNewPoL(testPoL1)}
+	poxList.RefreshStatus(context.Background())
+
+	// cancel once the first registration has been sent
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for srv.Requests(portal.RegisterPath) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	report, err := poxList.Register(ctx)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Register() error = %v, want %v", err, ErrInterrupted)
+	}
+	if got := len(report.Skipped()); got != 2 {
+		t.Errorf("len(Skipped()) = %d, want 2", got)
+	}
+
+	// the PoS being registered is completed, the others are left untouched
+	want := []statutes.LicenseStatus{statutes.Registered, statutes.Purchased, statutes.Purchased}
+	for i, pox := range poxList {
+		if pox.Status != want[i] {
+			t.Errorf("%s: Status = %v, want %v", pox.pox, pox.Status, want[i])
+		}
+	}
+	if got := srv.Requests(portal.RegisterPath); got != 1 {
+		t.Errorf("%d registrations sent, want 1", got)
+	}
+}
+
+func TestPoXList_ChangeBinding(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoL(testPoL1)
+	srv.AddPoS(testPoS1)
+
+	poxList := PoXList{mustNewPoL(testPoL1), mustNewPoS(testPoS1)}
+	poxList.RefreshStatus(context.Background())
+	poxList.Register(context.Background())
+
+	cfg.Binding = "10.0.0.1"
+	poxList.ChangeBinding(context.Background())
+
+	if got := poxList[0].Binding; got != "10.0.0.1" {
+		t.Errorf("PoL Binding = %q, want %q", got, "10.0.0.1")
+	}
+	if got := srv.Requests(portal.ChangeAddressPath); got != 1 {
+		t.Errorf("%d binding changes sent, want 1", got)
+	}
+}
+
+func TestPoXList_Download(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	srv.AddPoL(testPoL1)
+	srv.AddPoS(testPoS2)
+
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoL(testPoL1), mustNewPoS(testPoS2)}
+	poxList.RefreshStatus(context.Background())
+	poxList[:2].Register(context.Background())
+	poxList.Download(context.Background())
+
+	for _, pox := range poxList[:2] {
+		data, err := ioutil.ReadFile(filepath.Join(cfg.LicensesOutputDir, pox.LicenseFile))
+		if err != nil {
+			t.Errorf("%s: %v", pox.pox, err)
+			continue
+		}
+		if len(data) == 0 {
+			t.Errorf("%s: empty license file", pox.pox)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cfg.LicensesOutputDir, "*.jar"))
+	if len(files) != 2 {
+		t.Errorf("%d license files downloaded, want 2", len(files))
+	}
+
+	manifest, err := ReadManifest(cfg.LicensesOutputDir)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	for _, pox := range poxList[:2] {
+		e, ok := manifest.Get(pox.LicenseFile)
+		if !ok || e.PoX != pox.pox || e.LicenseID != pox.LicenseID || e.Size == 0 || len(e.SHA256) != 64 {
+			t.Errorf("manifest entry of %s = %+v", pox.pox, e)
+		}
+	}
+}
+
+func TestPoXList_DownloadManifest(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1)
+	srv.AddPoS(testPoS2)
+
+	poxList := PoXList{mustNewPoS(testPoS1), mustNewPoS(testPoS2)}
+	poxList.RefreshStatus(context.Background())
+	poxList.Register(context.Background())
+	report, _ := poxList.Download(context.Background())
+	if got := len(report.Changed()); got != 2 {
+		t.Fatalf("first download: %d changed, want 2", got)
+	}
+
+	// unchanged files are not downloaded again, altered ones are
+	ioutil.WriteFile(filepath.Join(cfg.LicensesOutputDir, poxList[1].LicenseFile), []byte("altered"), 0644)
+	requests := srv.Requests(portal.LicenseFilePath)
+	report, _ = poxList.Download(context.Background())
+	if changed := report.Changed(); len(changed) != 1 || changed[0].PoX != poxList[1] {
+		t.Errorf("second download: changed = %+v, want %s only", changed, testPoS2)
+	}
+	if got := srv.Requests(portal.LicenseFilePath) - requests; got != 1 {
+		t.Errorf("second download: %d license files requested, want 1", got)
+	}
+	if len(report.Failed()) != 0 {
+		t.Errorf("second download: failed = %+v", report.Failed())
+	}
+}
+
+func TestPoXList_DownloadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"html", []byte("<html><body>Session expired</body></html>"), ErrHTMLLicenseFile},
+		{"empty", []byte{}, ErrEmptyLicenseFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestPortal(t)
+			srv.AddPoS(testPoS1).FileContent = tt.content
+
+			poxList := PoXList{mustNewPoS(testPoS1)}
+			poxList.RefreshStatus(context.Background())
+			poxList.Register(context.Background())
+			report, _ := poxList.Download(context.Background())
+
+			failed := report.Failed()
+			if len(failed) != 1 || !errors.Is(failed[0].Err, tt.want) {
+				t.Errorf("Failed() = %+v, want %v", failed, tt.want)
+			}
+			if files, _ := ioutil.ReadDir(cfg.LicensesOutputDir); len(files) != 0 {
+				t.Errorf("%d files written, want none", len(files))
+			}
+		})
+	}
+}
+
+func TestPoXList_DownloadUnchecked(t *testing.T) {
+	srv := newTestPortal(t)
+	srv.AddPoS(testPoS1).FileContent = []byte("PK garbage")
+
+	poxList := PoXList{mustNewPoS(testPoS1)}
+	poxList.RefreshStatus(context.Background())
+	poxList.Register(context.Background())
+	report, err := poxList.Download(context.Background())
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	// a file the license file parser does not understand is kept, and flagged
+	if got := len(report.Changed()); got != 1 {
+		t.Errorf("len(Changed()) = %d, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LicensesOutputDir, poxList[0].LicenseFile)); err != nil {
+		t.Errorf("license file not written: %v", err)
+	}
+	manifest, _ := ReadManifest(cfg.LicensesOutputDir)
+	if e, ok := manifest.Get(poxList[0].LicenseFile); !ok || !strings.Contains(e.CheckError, license_file.ErrNotLicenseFile.Error()) {
+		t.Errorf("manifest entry = %+v, want a check error", e)
+	}
+}
+
+func TestReadPoXFormArgs(t *testing.T) {
+	newTestPortal(t)
+	ioutil.WriteFile("purchase.html", []byte("<td>"+testPoS1+"</td><td>"+testPoL1+"</td>"), 0644)
+	ioutil.WriteFile("engines.txt", []byte(testPoS1+"\n"+testPoS2+"\n"), 0644)
+
+	poxList, err := ReadPoXFormArgs([]string{testPoS3, "purchase.html", "engines.txt"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+
+	want := map[string]string{
+		testPoS1: "purchase.html:1",
+		testPoS2: "engines.txt:2",
+		testPoS3: "command-line",
+		testPoL1: "purchase.html:1",
+	}
+	if len(poxList) != len(want) {
+		t.Fatalf("%d PoS/PoL read, want %d", len(poxList), len(want))
+	}
+	for _, pox := range poxList {
+		if location, ok := want[pox.pox]; !ok || pox.Location() != location {
+			t.Errorf("%s: Location() = %q, want %q", pox.pox, pox.Location(), location)
+		}
+	}
+
+	if _, err := ReadPoXFormArgs([]string{"missing.txt"}, false, false); err == nil {
+		t.Errorf("ReadPoXFormArgs() error = nil, want an error")
+	}
+}
+
+// TestReadPoXFormArgs_Only checks --pos-only and --pol-only, whose arguments
+// used to be swapped, on the PoS/PoL given on command-line and in files
+func TestReadPoXFormArgs_Only(t *testing.T) {
+	newTestPortal(t)
+	ioutil.WriteFile("purchase.html", []byte("<td>"+testPoS1+"</td><td>"+testPoL1+"</td>"), 0644)
+	args := []string{testPoS2, "purchase.html"}
+
+	tests := []struct {
+		name             string
+		posOnly, polOnly bool
+		want             []string
+	}{
+		{"all", false, false, []string{testPoL1, testPoS2, testPoS1}},
+		{"pos-only", true, false, []string{testPoS2, testPoS1}},
+		{"pol-only", false, true, []string{testPoL1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poxList, err := ReadPoXFormArgs(args, tt.posOnly, tt.polOnly)
+			if err != nil {
+				t.Fatalf("ReadPoXFormArgs() error = %v", err)
+			}
+			got := make([]string, 0, len(poxList))
+			for _, pox := range poxList {
+				got = append(got, pox.pox)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ReadPoXFormArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPoXFormArgs_StdinDirectory(t *testing.T) {
+	newTestPortal(t)
+	cfg.Include = []string{"*.html", "*.txt"}
+	cfg.Exclude = []string{"archive", "draft-*"}
+
+	os.MkdirAll(filepath.Join("purchases", "2023", "archive"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join("purchases", "2023", "purchase.html"), []byte(testPoS1+" "+testPoL1), 0644)
+	ioutil.WriteFile(filepath.Join("purchases", "2023", "draft-purchase.html"), []byte(testPoS2), 0644)
+	ioutil.WriteFile(filepath.Join("purchases", "2023", "archive", "old.html"), []byte(testPoS2), 0644)
+	ioutil.WriteFile(filepath.Join("purchases", "engines.csv"), []byte(testPoS2), 0644)
+
+	previous := Stdin
+	Stdin = strings.NewReader("some tool output\n" + testPoS3 + "\n")
+	t.Cleanup(func() { Stdin = previous })
+
+	poxList, err := ReadPoXFormArgs([]string{"-", "purchases"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+	want := map[string]string{
+		testPoS1: filepath.Join("purchases", "2023", "purchase.html"),
+		testPoL1: filepath.Join("purchases", "2023", "purchase.html"),
+		testPoS3: "stdin",
+	}
+	if len(poxList) != len(want) {
+		t.Fatalf("ReadPoXFormArgs() = %v, want %d PoS/PoL", poxList, len(want))
+	}
+	for _, pox := range poxList {
+		if source, ok := want[pox.pox]; !ok || pox.Source != source {
+			t.Errorf("%s: Source = %q, want %q", pox.pox, pox.Source, source)
+		}
+	}
+
+	// --pos-only keeps the PoS only
+	poxList, err = ReadPoXFormArgs([]string{"purchases"}, true, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+	if len(poxList) != 1 || poxList[0].pox != testPoS1 {
+		t.Errorf("ReadPoXFormArgs(posOnly) = %v, want %s only", poxList, testPoS1)
+	}
+}
@@ -0,0 +1,168 @@
+package pox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// Report
+
+// Action is the bulk operation a Report is about
+type Action string
+
+const (
+	ActionRefresh       Action = "refresh"
+	ActionRegister      Action = "register"
+	ActionChangeBinding Action = "change-binding"
+	ActionDownload      Action = "download"
+	ActionInstall       Action = "install"
+)
+
+// State is the part of a PoX which bulk operations may change
+type State struct {
+	Status             statutes.LicenseStatus `json:"licence_status"`
+	Binding            string                 `json:"binding,omitempty"`
+	MaintenanceStatus  statutes.SupportStatus `json:"support_status,omitempty"`
+	MaintenanceEndDate string                 `json:"support_end_date,omitempty"`
+	LicenseFile        string                 `json:"license_file,omitempty"`
+}
+
+func (pox *PoX) State() State {
+	return State{
+		Status:             pox.Status,
+		Binding:            pox.Binding,
+		MaintenanceStatus:  pox.MaintenanceStatus,
+		MaintenanceEndDate: pox.MaintenanceEndDate,
+		LicenseFile:        pox.LicenseFile,
+	}
+}
+
+// Result is the outcome of an action on a single PoS/PoL. Skipped results are
+// the PoS/PoL left untouched because the operation has been interrupted.
+type Result struct {
+	PoX      *PoX
+	Action   Action
+	Before   State
+	After    State
+	Changed  bool
+	Skipped  bool
+	Duration time.Duration
+	Err      error
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	obj := struct {
+		PoX      string  `json:"pox"`
+		Type     PoXType `json:"type"`
+		Source   string  `json:"source,omitempty"`
+		Action   Action  `json:"action"`
+		Before   State   `json:"before"`
+		After    State   `json:"after"`
+		Changed  bool    `json:"changed"`
+		Skipped  bool    `json:"skipped,omitempty"`
+		Duration string  `json:"duration"`
+		Error    string  `json:"error,omitempty"`
+	}{
+		PoX:      r.PoX.pox,
+		Type:     r.PoX.poxType,
+		Source:   r.PoX.Location(),
+		Action:   r.Action,
+		Before:   r.Before,
+		After:    r.After,
+		Changed:  r.Changed,
+		Skipped:  r.Skipped,
+		Duration: r.Duration.Truncate(time.Millisecond).String(),
+	}
+	if r.Err != nil {
+		obj.Error = r.Err.Error()
+	}
+
+	return json.Marshal(obj)
+}
+
+// Report gathers the results of a bulk operation
+type Report struct {
+	Action   Action
+	Start    time.Time
+	Duration time.Duration
+	Results  []Result
+}
+
+func (r *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Action   Action    `json:"action"`
+		Start    time.Time `json:"start"`
+		Duration string    `json:"duration"`
+		Results  []Result  `json:"results"`
+	}{
+		Action:   r.Action,
+		Start:    r.Start,
+		Duration: r.Duration.Truncate(time.Millisecond).String(),
+		Results:  r.Results,
+	})
+}
+
+func (r *Report) filter(fct func(Result) bool) (res []Result) {
+	res = make([]Result, 0)
+	if r == nil {
+		return res
+	}
+	for _, result := range r.Results {
+		if fct(result) {
+			res = append(res, result)
+		}
+	}
+
+	return res
+}
+
+// Changed returns the results of the PoS/PoL successfully changed
+func (r *Report) Changed() []Result {
+	return r.filter(func(res Result) bool { return res.Changed && res.Err == nil })
+}
+
+// Failed returns the results of the PoS/PoL on which the action failed
+func (r *Report) Failed() []Result {
+	return r.filter(func(res Result) bool { return res.Err != nil })
+}
+
+// Skipped returns the results of the PoS/PoL not processed
+func (r *Report) Skipped() []Result {
+	return r.filter(func(res Result) bool { return res.Skipped })
+}
+
+// Err returns an error when the action failed on some PoS/PoL
+func (r *Report) Err() error {
+	if failed := r.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%s failed on %d PoS/PoL", r.Action, len(failed))
+	}
+	return nil
+}
+
+// Display displays the PoS/PoL on which the action failed or was skipped
+func (r *Report) Display() {
+	failed, skipped := r.Failed(), r.Skipped()
+	if len(failed) == 0 && len(skipped) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s: %d processed in %v, %d changed, %d failed, %d skipped\n",
+		r.Action,
+		len(r.Results)-len(skipped),
+		r.Duration.Truncate(time.Millisecond),
+		len(r.Changed()),
+		len(failed),
+		len(skipped),
+	)
+	for _, res := range failed {
+		fmt.Printf("- %s %s -> %s: %s\n", res.PoX, res.Before.Status, res.After.Status, aurora.Yellow(res.Err))
+	}
+	for _, res := range skipped {
+		fmt.Printf("- %s %s\n", res.PoX, aurora.Gray(12, "skipped"))
+	}
+}
@@ -0,0 +1,77 @@
+package pox
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+func TestReport(t *testing.T) {
+	pos1, pos2, pos3 := mustNewPoS(testPoS1), mustNewPoS(testPoS2), mustNewPoS(testPoS3)
+	report := &Report{
+		Action:   ActionRegister,
+		Duration: 1500 * time.Millisecond,
+		Results: []Result{
+			{PoX: pos1, Action: ActionRegister, Before: State{Status: statutes.Purchased}, After: State{Status: statutes.Registered}, Changed: true},
+			{PoX: pos2, Action: ActionRegister, Before: State{Status: statutes.Purchased}, After: State{Status: statutes.RegistrationError}, Err: errors.New("failed")},
+			{PoX: pos3, Action: ActionRegister, Skipped: true},
+		},
+	}
+
+	if got := len(report.Changed()); got != 1 {
+		t.Errorf("len(Changed()) = %d, want 1", got)
+	}
+	if got := len(report.Failed()); got != 1 {
+		t.Errorf("len(Failed()) = %d, want 1", got)
+	}
+	if got := len(report.Skipped()); got != 1 {
+		t.Errorf("len(Skipped()) = %d, want 1", got)
+	}
+	if report.Err() == nil {
+		t.Errorf("Err() = nil, want an error")
+	}
+
+	var nilReport *Report
+	if nilReport.Err() != nil || len(nilReport.Changed()) != 0 {
+		t.Errorf("nil report has results")
+	}
+
+	out, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var got struct {
+		Action   string `json:"action"`
+		Duration string `json:"duration"`
+		Results  []struct {
+			PoX    string `json:"pox"`
+			Type   string `json:"type"`
+			Before struct {
+				Status string `json:"licence_status"`
+			} `json:"before"`
+			After struct {
+				Status string `json:"licence_status"`
+			} `json:"after"`
+			Skipped bool   `json:"skipped"`
+			Error   string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Action != "register" || got.Duration != "1.5s" || len(got.Results) != 3 {
+		t.Fatalf("unexpected report %s", out)
+	}
+	if r := got.Results[0]; r.PoX != testPoS1 || r.Type != string(PoS) || r.Before.Status != string(statutes.Purchased) || r.After.Status != string(statutes.Registered) {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if r := got.Results[1]; r.Error != "failed" {
+		t.Errorf("Error = %q, want %q", r.Error, "failed")
+	}
+	if r := got.Results[2]; !r.Skipped {
+		t.Errorf("Skipped = false, want true")
+	}
+}
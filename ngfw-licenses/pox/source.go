@@ -0,0 +1,327 @@
+package pox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//=================================================================
+// Sources
+
+// Item is a PoS/PoL identifier read from a Source
+type Item struct {
+	ID   string
+	Type PoXType
+	// Source is where the identifier has been read from, and Line its line
+	// there, 0 when unknown
+	Source   string
+	Line     int
+	Metadata map[string]string
+	// Lint is set, instead of ID and Type, on the words which look almost
+	// like a PoS/PoL
+	Lint *Lint
+}
+
+// Source yields the PoS/PoL identifiers of a command-line argument
+type Source interface {
+	// Name is the file, URL... read by the Source
+	Name() string
+	Items() ([]Item, error)
+}
+
+// SourceOpener returns the Sources of a command-line argument, or nil when the
+// argument is not one of its kind
+type SourceOpener func(arg string) ([]Source, error)
+
+type sourceKind struct {
+	name string
+	open SourceOpener
+}
+
+// sourceKinds are tried in order on each argument, the arguments none of them
+// opens being files or directories
+var sourceKinds = []sourceKind{
+	{"identifier", openArg},
+	{"stdin", openStdin},
+	{"url", openURL},
+}
+
+// RegisterSource adds a kind of Source, tried on each argument after the ones
+// already registered
+func RegisterSource(name string, open SourceOpener) {
+	sourceKinds = append(sourceKinds, sourceKind{name, open})
+}
+
+// openSources returns the Sources of a command-line argument
+func openSources(arg string) ([]Source, error) {
+	for _, kind := range sourceKinds {
+		sources, err := kind.open(arg)
+		if err != nil {
+			return nil, err
+		}
+		if sources != nil {
+			Logger.Debugf("%s read as %s", arg, kind.name)
+			return sources, nil
+		}
+	}
+	return openPath(arg)
+}
+
+//=================================================================
+// Built-in sources
+
+const (
+	commandLineName = "command-line"
+	stdinName       = "stdin"
+)
+
+// Stdin is read when "-" is given on command-line
+var Stdin io.Reader = os.Stdin
+
+// argSource is a PoS/PoL given on command-line
+type argSource struct {
+	item Item
+}
+
+func openArg(arg string) ([]Source, error) {
+	id := strings.ToLower(strings.TrimSpace(normalize(arg)))
+	if t := identifierType(id); t != "" {
+		return []Source{argSource{Item{ID: id, Type: t}}}, nil
+	}
+
+	// a mistyped PoS/PoL would be reported as a missing file
+	if _, err := os.Stat(arg); os.IsNotExist(err) {
+		if items := scanLine(arg); len(items) == 1 && items[0].Lint != nil {
+			items[0].Lint.Source = commandLineName
+			return nil, fmt.Errorf("%s", items[0].Lint)
+		}
+	}
+	return nil, nil
+}
+
+func (s argSource) Name() string { return commandLineName }
+
+func (s argSource) Items() ([]Item, error) { return []Item{s.item}, nil }
+
+// stdinSource is the content given on stdin by "-"
+type stdinSource struct{}
+
+func openStdin(arg string) ([]Source, error) {
+	if arg != "-" {
+		return nil, nil
+	}
+	return []Source{stdinSource{}}, nil
+}
+
+func (s stdinSource) Name() string { return stdinName }
+
+func (s stdinSource) Items() ([]Item, error) {
+	data, err := ioutil.ReadAll(Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read stdin: %w", err)
+	}
+	return readContent("", data)
+}
+
+// urlSource is a file downloaded over HTTP(S), its format being told by the
+// name ending its path
+type urlSource struct {
+	url string
+}
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+func openURL(arg string) ([]Source, error) {
+	if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+		return nil, nil
+	}
+	return []Source{urlSource{arg}}, nil
+}
+
+func (s urlSource) Name() string { return s.url }
+
+func (s urlSource) Items() ([]Item, error) {
+	resp, err := httpClient.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", s.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download %s: %s", s.url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", s.url, err)
+	}
+
+	name := s.url
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	return readContent(path.Base(name), data)
+}
+
+// fileSource is a file, given on command-line or found in a directory
+type fileSource struct {
+	path string
+}
+
+// openPath returns the file, or the files of the directory, see inputFiles
+func openPath(arg string) ([]Source, error) {
+	files, err := inputFiles(arg)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Source, 0, len(files))
+	for _, file := range files {
+		res = append(res, fileSource{file})
+	}
+	return res, nil
+}
+
+func (s fileSource) Name() string { return s.path }
+
+func (s fileSource) Items() ([]Item, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return readContent(s.path, data)
+}
+
+// inputFiles returns path when it is a file, or the files found walking the
+// path directory which match cfg.Include and not cfg.Exclude
+func inputFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	res := make([]string, 0)
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != path && matchGlobs(cfg.Exclude, path, file) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && (len(cfg.Include) == 0 || matchGlobs(cfg.Include, path, file)) {
+			res = append(res, file)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// matchGlobs tells if the name, or the path relative to root, of file matches
+// one of the globs
+func matchGlobs(globs []string, root, file string) bool {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		rel = file
+	}
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, filepath.Base(file)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//=================================================================
+// Formats
+
+// Format reads the PoS/PoL identifiers of a file content
+type Format struct {
+	Name string
+	// Match tells if the content data of the file name is of this format,
+	// name being empty for stdin
+	Match func(name string, data []byte) bool
+	Read  func(name string, data []byte) ([]Item, error)
+}
+
+// formats are tried in order on each file, the files none of them matches
+// being read as text
+var formats = []Format{
+	{
+		Name:  "table",
+		Match: func(name string, data []byte) bool { return isTable(name) },
+		Read:  readTableItems,
+	},
+}
+
+// RegisterFormat adds a Format, tried on each file after the ones already
+// registered
+func RegisterFormat(format Format) {
+	formats = append(formats, format)
+}
+
+// readContent returns the PoS/PoL identifiers of the content of a file
+func readContent(name string, data []byte) ([]Item, error) {
+	for _, format := range formats {
+		if format.Match(name, data) {
+			return format.Read(name, data)
+		}
+	}
+	return readTextItems(name, data)
+}
+
+// readTextItems returns the PoS/PoL found in the text of a file, see
+// extractText. Lines are known for plain text files only.
+func readTextItems(name string, data []byte) ([]Item, error) {
+	text := extractText(name, data)
+	return findItems(text, bytes.Equal(text, data)), nil
+}
+
+// findItems returns the PoS/PoL found in text, and the words which look almost
+// like one, with their line when lines is true
+func findItems(text []byte, lines bool) []Item {
+	res := make([]Item, 0)
+	for i, l := range bytes.Split(text, []byte("\n")) {
+		for _, item := range scanLine(string(l)) {
+			if lines {
+				item.Line = i + 1
+			}
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// readTableItems returns the PoS/PoL of the rows of a CSV or XLSX file, with
+// the metadata of their row
+func readTableItems(name string, data []byte) ([]Item, error) {
+	rows, err := readTable(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Item, 0)
+	for _, row := range rows {
+		for _, item := range findItems([]byte(strings.Join(row.values, "\n")), false) {
+			item.Line = row.line
+			if len(row.metadata) > 0 {
+				item.Metadata = row.metadata
+			}
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,107 @@
+package pox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// customSource yields a PoS for the "custom:" arguments
+type customSource struct {
+	arg string
+}
+
+func (s customSource) Name() string { return s.arg }
+
+func (s customSource) Items() ([]Item, error) {
+	return []Item{{ID: testPoS2, Type: PoS, Line: 7, Metadata: map[string]string{"site": "Paris"}}}, nil
+}
+
+func TestReadPoXFormArgs_Sources(t *testing.T) {
+	newTestPortal(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/exports/engines.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("Engine,PoS\nfw-paris," + testPoS1 + "\nfw-lyon," + testPoS3 + "\n"))
+	}))
+	defer srv.Close()
+
+	previousKinds, previousFormats := sourceKinds, formats
+	t.Cleanup(func() { sourceKinds, formats = previousKinds, previousFormats })
+	RegisterSource("custom", func(arg string) ([]Source, error) {
+		if !strings.HasPrefix(arg, "custom:") {
+			return nil, nil
+		}
+		return []Source{customSource{arg}}, nil
+	})
+	// a format telling PoL by a magic prefix
+	RegisterFormat(Format{
+		Name:  "pol-list",
+		Match: func(name string, data []byte) bool { return bytes.HasPrefix(data, []byte("#POL\n")) },
+		Read: func(name string, data []byte) ([]Item, error) {
+			return []Item{{ID: strings.TrimSpace(string(data[5:])), Type: PoL, Line: 2}}, nil
+		},
+	})
+	ioutil.WriteFile("pol.list", []byte("#POL\n"+testPoL1+"\n"), 0644)
+
+	poxList, err := ReadPoXFormArgs([]string{srv.URL + "/exports/engines.csv?format=csv", "custom:paris", "pol.list"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+
+	want := map[string]string{
+		testPoL1: "pol.list:2",
+		testPoS1: srv.URL + "/exports/engines.csv?format=csv:2",
+		testPoS3: srv.URL + "/exports/engines.csv?format=csv:3",
+		testPoS2: "custom:paris:7",
+	}
+	if len(poxList) != len(want) {
+		t.Fatalf("ReadPoXFormArgs() = %v, want %d PoS/PoL", poxList, len(want))
+	}
+	for _, pox := range poxList {
+		if location, ok := want[pox.pox]; !ok || pox.Location() != location {
+			t.Errorf("%s: Location() = %q, want %q", pox.pox, pox.Location(), location)
+		}
+	}
+	if poxList[0].pox != testPoL1 {
+		t.Errorf("ReadPoXFormArgs() = %v, want PoL first", poxList)
+	}
+	if p := poxList.GetAllPoS()[0]; p.pox != testPoS1 || p.Metadata["engine"] != "fw-paris" {
+		t.Errorf("%s: Metadata = %v, want engine:fw-paris", p.pox, p.Metadata)
+	}
+
+	if _, err := ReadPoXFormArgs([]string{srv.URL + "/missing.txt"}, false, false); err == nil {
+		t.Errorf("ReadPoXFormArgs() error = nil, want an error")
+	}
+}
+
+func TestFindItems(t *testing.T) {
+	text := []byte("PoS " + testPoS1 + "\n\nPoL " + testPoL1 + " and PoS " + testPoS2 + "\n")
+
+	items := findItems(text, true)
+	want := []Item{
+		{ID: testPoS1, Type: PoS, Line: 1},
+		{ID: testPoL1, Type: PoL, Line: 3},
+		{ID: testPoS2, Type: PoS, Line: 3},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("findItems() = %+v, want %+v", items, want)
+	}
+	for i := range want {
+		if items[i].ID != want[i].ID || items[i].Type != want[i].Type || items[i].Line != want[i].Line {
+			t.Errorf("findItems()[%d] = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+
+	for _, item := range findItems(text, false) {
+		if item.Line != 0 {
+			t.Errorf("findItems(lines=false) %s: Line = %d, want 0", item.ID, item.Line)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package pox
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+)
+
+//=================================================================
+// CSV/XLSX import
+
+// tableExtensions are the files read as tables, PoS/PoL being read from their
+// columns along with the metadata of each row
+var tableExtensions = map[string]bool{".csv": true, ".xlsx": true}
+
+// tableRow is a PoS/PoL list row, with the metadata of its other columns, line
+// being its row number in the file
+type tableRow struct {
+	line     int
+	values   []string
+	metadata map[string]string
+}
+
+func isTable(filename string) bool {
+	return tableExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// readTable returns the rows of a CSV or XLSX file, the first non-empty row
+// being the header. PoS/PoL are read in the columns given by cfg.Import, or in
+// every column when none of them is found. Metadata are the columns given by
+// cfg.Import, or every other column, keyed by their header.
+func readTable(filename string, data []byte) ([]tableRow, error) {
+	var records [][]string
+	var err error
+	if strings.ToLower(filepath.Ext(filename)) == ".xlsx" {
+		records, err = readXLSX(data, cfg.Import.Sheet)
+	} else {
+		records, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	first := 0
+	for first < len(records) && emptyRecord(records[first]) {
+		first++
+	}
+	if first == len(records) {
+		return nil, nil
+	}
+	header := records[first]
+
+	posColumns, polColumns := cfg.Import.PoSColumns, cfg.Import.PoLColumns
+	if len(posColumns) == 0 && len(polColumns) == 0 {
+		posColumns, polColumns = config.DefaultImport.PoSColumns, config.DefaultImport.PoLColumns
+	}
+
+	poxColumns := make([]int, 0)
+	metadataColumns := make(map[string]int)
+	for i, name := range header {
+		switch {
+		case matchColumn(posColumns, name) || matchColumn(polColumns, name):
+			poxColumns = append(poxColumns, i)
+		case len(cfg.Import.Metadata) == 0 && strings.TrimSpace(name) != "":
+			metadataColumns[metadataKey(name)] = i
+		}
+	}
+	for key, column := range cfg.Import.Metadata {
+		for i, name := range header {
+			if matchColumn([]string{column}, name) {
+				metadataColumns[metadataKey(key)] = i
+			}
+		}
+	}
+
+	rows := make([]tableRow, 0, len(records)-first-1)
+	for i := first + 1; i < len(records); i++ {
+		record := records[i]
+		row := tableRow{line: i + 1, metadata: make(map[string]string)}
+		if len(poxColumns) == 0 {
+			row.values = record
+		}
+		for _, i := range poxColumns {
+			if i < len(record) {
+				row.values = append(row.values, record[i])
+			}
+		}
+		for key, i := range metadataColumns {
+			if i < len(record) && strings.TrimSpace(record[i]) != "" {
+				row.metadata[key] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func emptyRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func matchColumn(columns []string, name string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataKey returns the metadata key of a column header: "Engine name" gives
+// engine_name
+func metadataKey(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(name, "-", " "))), "_")
+}
+
+// readCSV reads a CSV file, separated by commas, or by semicolons when its
+// first line has more semicolons than commas
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		r.Comma = ';'
+	}
+	return r.ReadAll()
+}
+
+//=================================================================
+// XLSX
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Ref   int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				T string `xml:"t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads the cells of a sheet of an XLSX file, the first one when
+// sheet is empty
+func readXLSX(data []byte, sheet string) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	if err := readXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if err := readXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	target := ""
+	for _, s := range workbook.Sheets {
+		if sheet != "" && s.Name != sheet {
+			continue
+		}
+		for _, rel := range rels.Relationships {
+			if rel.ID == s.ID {
+				target = rel.Target
+			}
+		}
+		break
+	}
+	if target == "" {
+		return nil, fmt.Errorf("sheet %q not found", sheet)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	var sharedStrings xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXML(files, "xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+	strs := make([]string, len(sharedStrings.Items))
+	for i, item := range sharedStrings.Items {
+		strs[i] = item.T
+		for _, r := range item.Runs {
+			strs[i] += r.T
+		}
+	}
+
+	var worksheet xlsxWorksheet
+	if err := readXML(files, target, &worksheet); err != nil {
+		return nil, err
+	}
+
+	records := make([][]string, 0, len(worksheet.Rows))
+	for _, row := range worksheet.Rows {
+		// empty rows may be missing as well
+		for row.Ref > len(records)+1 {
+			records = append(records, nil)
+		}
+		record := make([]string, 0, len(row.Cells))
+		for _, c := range row.Cells {
+			// cells may be missing, their column is given by their reference
+			if i := columnIndex(c.Ref); i >= len(record) {
+				record = append(record, make([]string, i-len(record))...)
+			}
+			value := c.Value
+			switch c.Type {
+			case "s":
+				if i, err := strconv.Atoi(c.Value); err == nil && i < len(strs) {
+					value = strs[i]
+				}
+			case "inlineStr":
+				value = c.Inline.T
+			}
+			record = append(record, value)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func readXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("invalid XLSX file: %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// a part inflating over maxZipEntrySize is rejected before being parsed
+	data, err := readLimited(rc, 0)
+	if err != nil {
+		return fmt.Errorf("invalid XLSX file: %s: %w", name, err)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid XLSX file: %s: %w", name, err)
+	}
+	return nil
+}
+
+// columnIndex returns the column of a cell reference: 0 for A1, 27 for AB3,
+// -1 when the reference is empty
+func columnIndex(ref string) int {
+	res := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		res = res*26 + int(c-'A') + 1
+	}
+	return res - 1
+}
+
+//=================================================================
+// Metadata
+
+// metadataString returns the metadata, sorted by key
+func (pox PoX) metadataString() string {
+	keys := make([]string, 0, len(pox.Metadata))
+	for k := range pox.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]string, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, fmt.Sprintf("%s:%q", k, pox.Metadata[k]))
+	}
+	return strings.Join(res, ", ")
+}
+
+// MetadataKeys returns the metadata keys of the PoS/PoL, sorted
+func (poxList PoXList) MetadataKeys() []string {
+	keys := make(map[string]bool)
+	for _, pox := range poxList {
+		for k := range pox.Metadata {
+			keys[k] = true
+		}
+	}
+	res := make([]string, 0, len(keys))
+	for k := range keys {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
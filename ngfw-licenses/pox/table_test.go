@@ -0,0 +1,136 @@
+package pox
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newXLSX returns an XLSX file whose first sheet holds rows, the cells of the
+// first row being shared strings and the other ones inline strings. Empty
+// cells are left out.
+func newXLSX(t *testing.T, rows [][]string) []byte {
+	t.Helper()
+
+	var sheet, sst strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	sst.WriteString(`<?xml version="1.0" encoding="UTF-8"?><sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	for i, row := range rows {
+		sheet.WriteString(`<row>`)
+		for j, v := range row {
+			if v == "" {
+				continue
+			}
+			ref := string(rune('A'+j)) + string(rune('1'+i))
+			if i == 0 {
+				sheet.WriteString(`<c r="` + ref + `" t="s"><v>` + string(rune('0'+j)) + `</v></c>`)
+				sst.WriteString(`<si><r><t>` + v[:1] + `</t></r><r><t>` + v[1:] + `</t></r></si>`)
+			} else {
+				sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t>` + v + `</t></is></c>`)
+			}
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	sst.WriteString(`</sst>`)
+
+	files := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?><workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Purchases" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": sheet.String(),
+		"xl/sharedStrings.xml":     sst.String(),
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadPoXFormArgs_Tables(t *testing.T) {
+	newTestPortal(t)
+
+	ioutil.WriteFile("purchases.csv", []byte("\xef\xbb\xbfCustomer;Site;Engine name;PoS;Comment\n"+
+		"Acme;Paris;fw-paris;"+testPoS1+";see 9999999999-9999999999 too\n"+
+		";;;;\n"+
+		"Acme;Lyon;fw-lyon;"+testPoS2+";\n"), 0644)
+	ioutil.WriteFile("purchases.xlsx", newXLSX(t, [][]string{
+		{"Customer", "Site", "Engine name", "PoL"},
+		{"Globex", "", "fw-virtual", testPoL1},
+	}), 0644)
+
+	poxList, err := ReadPoXFormArgs([]string{"purchases.csv", "purchases.xlsx"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+
+	// the comment column is not a PoS/PoL column
+	want := map[string]map[string]string{
+		testPoS1: {"customer": "Acme", "site": "Paris", "engine_name": "fw-paris", "comment": "see 9999999999-9999999999 too"},
+		testPoS2: {"customer": "Acme", "site": "Lyon", "engine_name": "fw-lyon"},
+		testPoL1: {"customer": "Globex", "engine_name": "fw-virtual"},
+	}
+	if len(poxList) != len(want) {
+		t.Fatalf("ReadPoXFormArgs() = %v, want %d PoS/PoL", poxList, len(want))
+	}
+	for _, pox := range poxList {
+		if !reflect.DeepEqual(pox.Metadata, want[pox.pox]) {
+			t.Errorf("%s: Metadata = %v, want %v", pox.pox, pox.Metadata, want[pox.pox])
+		}
+	}
+
+	if got, want := poxList.MetadataKeys(), []string{"comment", "customer", "engine_name", "site"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MetadataKeys() = %v, want %v", got, want)
+	}
+	if got := poxList[0].DetailedString(); !strings.Contains(got, `customer:"Globex"`) {
+		t.Errorf("DetailedString() = %s, want the metadata", got)
+	}
+
+	// mapped columns only
+	cfg.Import.PoSColumns = []string{"PoS", "Comment"}
+	cfg.Import.Metadata = map[string]string{"engine": "Engine name"}
+	poxList, err = ReadPoXFormArgs([]string{"purchases.csv"}, false, false)
+	if err != nil {
+		t.Fatalf("ReadPoXFormArgs() error = %v", err)
+	}
+	if len(poxList) != 3 {
+		t.Fatalf("ReadPoXFormArgs() = %v, want 3 PoS", poxList)
+	}
+	for _, pox := range poxList {
+		if pox.pox == testPoS2 && !reflect.DeepEqual(pox.Metadata, map[string]string{"engine": "fw-lyon"}) {
+			t.Errorf("%s: Metadata = %v", pox.pox, pox.Metadata)
+		}
+	}
+}
+
+func TestReadTable_XLSXLimit(t *testing.T) {
+	data := newXLSX(t, [][]string{{"PoS"}, {testPoS1}, {testPoS2}})
+	if _, err := readTable("purchases.xlsx", data); err != nil {
+		t.Fatalf("readTable() error = %v", err)
+	}
+
+	previous := maxZipEntrySize
+	t.Cleanup(func() { maxZipEntrySize = previous })
+	maxZipEntrySize = 64
+	if _, err := readTable("purchases.xlsx", data); !errors.Is(err, errTooLarge) {
+		t.Errorf("readTable() error = %v, want %v", err, errTooLarge)
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "C12": 2, "Z3": 25, "AB3": 27, "": -1} {
+		if got := columnIndex(ref); got != want {
+			t.Errorf("columnIndex(%q) = %d, want %d", ref, got, want)
+		}
+	}
+}
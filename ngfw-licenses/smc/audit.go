@@ -0,0 +1,195 @@
+package smc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// Audit
+
+// Finding is a discrepancy between the licenses installed on the SMC and the
+// PoS/PoL as seen by the license portal
+type Finding string
+
+const (
+	// NotInstalled licenses are registered on the portal, but not on the SMC
+	NotInstalled Finding = "not-installed"
+	// Expired licenses are installed on the SMC, and past their expiration date
+	Expired Finding = "expired"
+	// UnknownToPortal licenses are installed on the SMC, but their PoS/PoL is
+	// unknown or not registered on the portal
+	UnknownToPortal Finding = "unknown-to-portal"
+	// BindingMismatch PoL licenses are installed on the SMC with another IP
+	// binding than the portal one
+	BindingMismatch Finding = "binding-mismatch"
+)
+
+var Findings = []Finding{NotInstalled, Expired, UnknownToPortal, BindingMismatch}
+
+// expirationDateFormats are the formats of the license expiration dates
+var expirationDateFormats = []string{"2006-01-02", time.RFC3339}
+
+// AuditItem is a single discrepancy, PoX or LicenseID being empty when the
+// PoS/PoL or the license is missing
+type AuditItem struct {
+	Finding   Finding `json:"finding"`
+	PoX       string  `json:"pox,omitempty"`
+	LicenseID string  `json:"license_id,omitempty"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+// Audit reconciles the licenses installed on the SMC with the portal
+type Audit struct {
+	Date      time.Time   `json:"date"`
+	Installed int         `json:"installed"`
+	PoX       int         `json:"pox"`
+	Items     []AuditItem `json:"items"`
+}
+
+// LicensePoX returns the PoS/PoL of the installed licenses, for the portal to
+// be queried about them. Licenses without a valid PoS/PoL are left out.
+func LicensePoX(licenses []License) pox.PoXList {
+	res := make(pox.PoXList, 0, len(licenses))
+	for _, l := range licenses {
+		var p *pox.PoX
+		var err error
+		switch {
+		case l.ProofOfSerial != "":
+			p, err = pox.NewPoS(l.ProofOfSerial)
+		case l.ProofOfLicense != "":
+			p, err = pox.NewPoL(l.ProofOfLicense)
+		default:
+			continue
+		}
+		if err == nil {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// NewAudit reconciles the installed licenses with poxList, whose status has
+// been refreshed from the portal
+func NewAudit(licenses []License, poxList pox.PoXList, now time.Time) *Audit {
+	a := &Audit{Date: now, Installed: len(licenses), PoX: len(poxList), Items: make([]AuditItem, 0)}
+
+	installed := make(map[*pox.PoX]bool)
+	for _, l := range licenses {
+		p := findPoX(poxList, l)
+		if p != nil {
+			installed[p] = true
+		}
+
+		if end, ok := expirationTime(l.ExpirationDate); ok && end.Before(now) {
+			a.add(Expired, p, l.LicenseID, "expired on "+l.ExpirationDate)
+		}
+
+		switch {
+		case p == nil:
+			a.add(UnknownToPortal, nil, l.LicenseID, "no PoS/PoL")
+		case p.Status == statutes.Unreachable:
+			// the portal could not tell, the refresh report gives the error
+		case p.Status != statutes.Registered:
+			a.add(UnknownToPortal, p, l.LicenseID, "portal status is "+string(p.Status))
+		case p.Type() == pox.PoL && l.Binding != "" && p.Binding != "" && l.Binding != p.Binding:
+			a.add(BindingMismatch, p, l.LicenseID, fmt.Sprintf("SMC binding %s, portal binding %s", l.Binding, p.Binding))
+		}
+	}
+
+	for _, p := range poxList {
+		if p.Status == statutes.Registered && !installed[p] {
+			a.add(NotInstalled, p, p.LicenseID, p.ProductName)
+		}
+	}
+
+	sort.SliceStable(a.Items, func(i, j int) bool {
+		if a.Items[i].Finding != a.Items[j].Finding {
+			return findingIndex(a.Items[i].Finding) < findingIndex(a.Items[j].Finding)
+		}
+		return a.Items[i].PoX < a.Items[j].PoX
+	})
+	return a
+}
+
+// findPoX returns the PoS/PoL of an installed license
+func findPoX(poxList pox.PoXList, l License) *pox.PoX {
+	for _, p := range poxList {
+		if l.LicenseID != "" && p.LicenseID == l.LicenseID {
+			return p
+		}
+	}
+	for _, p := range poxList {
+		id := p.Identifier()
+		if strings.EqualFold(id, l.ProofOfSerial) || strings.EqualFold(id, l.ProofOfLicense) || (p.Type() == pox.PoS && strings.EqualFold(id, l.Binding)) {
+			return p
+		}
+	}
+	return nil
+}
+
+func expirationTime(date string) (time.Time, bool) {
+	for _, format := range expirationDateFormats {
+		if t, err := time.Parse(format, strings.TrimSpace(date)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func findingIndex(f Finding) int {
+	for i, finding := range Findings {
+		if f == finding {
+			return i
+		}
+	}
+	return len(Findings)
+}
+
+func (a *Audit) add(f Finding, p *pox.PoX, licenseID, detail string) {
+	item := AuditItem{Finding: f, LicenseID: licenseID, Detail: detail}
+	if p != nil {
+		item.PoX = p.Identifier()
+	}
+	a.Items = append(a.Items, item)
+}
+
+// Get returns the items of a finding
+func (a *Audit) Get(f Finding) (res []AuditItem) {
+	res = make([]AuditItem, 0)
+	for _, item := range a.Items {
+		if item.Finding == f {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Err returns an error when some discrepancies have been found
+func (a *Audit) Err() error {
+	if len(a.Items) > 0 {
+		return fmt.Errorf("%d discrepancies between the SMC and the license portal", len(a.Items))
+	}
+	return nil
+}
+
+// Display displays the discrepancies grouped by finding
+func (a *Audit) Display() {
+	fmt.Printf("\n%d licenses installed on the SMC, %d PoS/PoL on the portal, %d discrepancies\n", a.Installed, a.PoX, len(a.Items))
+	for _, f := range Findings {
+		items := a.Get(f)
+		if len(items) == 0 {
+			continue
+		}
+		fmt.Printf("\n%d %s:\n", len(items), aurora.Yellow(f))
+		for _, item := range items {
+			fmt.Printf("- %s %s %s\n", aurora.Green(item.PoX), item.LicenseID, aurora.Gray(12, item.Detail))
+		}
+	}
+}
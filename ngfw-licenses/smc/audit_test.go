@@ -0,0 +1,92 @@
+package smc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+func TestNewAudit(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	newPoX := func(new func(string) (*pox.PoX, error), id string, status statutes.LicenseStatus, licenseID, binding string) *pox.PoX {
+		p, err := new(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Status, p.LicenseID, p.Binding = status, licenseID, binding
+		return p
+	}
+	poxList := pox.PoXList{
+		newPoX(pox.NewPoS, testPoS1, statutes.Registered, "700001", testPoS1),
+		newPoX(pox.NewPoS, testPoS2, statutes.Registered, "700002", testPoS2),
+		newPoX(pox.NewPoS, testPoS3, statutes.Unknown, "", ""),
+		newPoX(pox.NewPoS, "5555555555-5555555555", statutes.Unreachable, "", ""),
+		newPoX(pox.NewPoL, testPoL1, statutes.Registered, "700004", "10.0.0.1"),
+	}
+	licenses := []License{
+		{LicenseID: "700001", Binding: testPoS1, ExpirationDate: "2024-01-01"},
+		{LicenseID: "700003", ProofOfSerial: testPoS3, ExpirationDate: "2023-01-01"},
+		{LicenseID: "700004", ProofOfLicense: testPoL1, Binding: "10.0.0.2", ExpirationDate: "Unlimited"},
+		{LicenseID: "700005", ProofOfSerial: "5555555555-5555555555"},
+		{LicenseID: "700006"},
+	}
+
+	got := NewAudit(licenses, poxList, now)
+	want := []AuditItem{
+		{Finding: NotInstalled, PoX: testPoS2, LicenseID: "700002"},
+		{Finding: Expired, PoX: testPoS3, LicenseID: "700003", Detail: "expired on 2023-01-01"},
+		{Finding: UnknownToPortal, LicenseID: "700006", Detail: "no PoS/PoL"},
+		{Finding: UnknownToPortal, PoX: testPoS3, LicenseID: "700003", Detail: "portal status is UNKNOWN"},
+		{Finding: BindingMismatch, PoX: testPoL1, LicenseID: "700004", Detail: "SMC binding 10.0.0.2, portal binding 10.0.0.1"},
+	}
+	if !reflect.DeepEqual(got.Items, want) {
+		t.Errorf("NewAudit() = %+v\nwant %+v", got.Items, want)
+	}
+	if got.Err() == nil {
+		t.Errorf("Err() = nil, want an error")
+	}
+
+	if got := NewAudit(licenses[:1], poxList[:1], now); got.Err() != nil {
+		t.Errorf("Err() = %v, want nil", got.Err())
+	}
+}
+
+func TestLicensePoX(t *testing.T) {
+	got := LicensePoX([]License{
+		{LicenseID: "700001", ProofOfSerial: testPoS1},
+		{LicenseID: "700004", ProofOfLicense: testPoL1},
+		{LicenseID: "700005", ProofOfSerial: "invalid"},
+		{LicenseID: "700006"},
+	})
+	if len(got) != 2 || got[0].Identifier() != testPoS1 || got[0].Type() != pox.PoS || got[1].Identifier() != testPoL1 || got[1].Type() != pox.PoL {
+		t.Errorf("LicensePoX() = %v", got)
+	}
+}
+
+func TestNewAudit_UpperCase(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	licenses := []License{
+		{LicenseID: "700001", ProofOfSerial: strings.ToUpper(testPoS1)},
+		{LicenseID: "700004", ProofOfLicense: strings.ToUpper(testPoL1)},
+	}
+
+	// the PoS/PoL of the SMC licenses are those read from files
+	poxList := LicensePoX(licenses)
+	if len(poxList) != 2 || poxList[0].Identifier() != testPoS1 || poxList[1].Identifier() != testPoL1 {
+		t.Fatalf("LicensePoX() = %v, want %s and %s", poxList, testPoS1, testPoL1)
+	}
+
+	// the portal does not tell the license IDs, installed licenses are found
+	// by their PoS/PoL
+	for _, p := range poxList {
+		p.Status = statutes.Registered
+	}
+	if got := NewAudit(licenses, poxList, now); len(got.Items) != 0 {
+		t.Errorf("NewAudit() = %+v, want no finding", got.Items)
+	}
+}
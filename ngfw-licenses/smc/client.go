@@ -0,0 +1,143 @@
+package smc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/go-resty/resty/v2"
+	"github.com/mbndr/logo"
+)
+
+var Logger *logo.Logger
+
+//=================================================================
+// Client
+
+const (
+	DefaultPort       = 8082
+	DefaultAPIVersion = "6.10"
+)
+
+var (
+	ErrMissingConfig = errors.New("smc section is missing from config file")
+	ErrLogin         = errors.New("unable to log in to the SMC")
+)
+
+// StatusError is returned when the SMC answers with an HTTP error status
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Details    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.URL, e.Status, e.Details)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// Client is a session on the SMC REST API. With DryRun, the calls changing the
+// SMC are logged instead of being sent.
+type Client struct {
+	BaseURL string
+	DryRun  bool
+
+	cfg  config.SMC
+	http *resty.Client
+}
+
+func NewClient(cfg *config.SMC) (*Client, error) {
+	if cfg == nil {
+		return nil, ErrMissingConfig
+	}
+	if cfg.IP == "" || cfg.APIKey == "" {
+		return nil, fmt.Errorf("%w: smc ip and api_key are mandatory", ErrMissingConfig)
+	}
+	c := *cfg
+	if c.Port == 0 {
+		c.Port = DefaultPort
+	}
+	if c.APIVersion == "" {
+		c.APIVersion = DefaultAPIVersion
+	}
+
+	scheme := "http"
+	if c.TLS {
+		scheme = "https"
+	}
+
+	return &Client{
+		BaseURL: fmt.Sprintf("%s://%s:%d/%s", scheme, c.IP, c.Port, c.APIVersion),
+		cfg:     c,
+		http: resty.New().
+			SetTimeout(time.Minute).
+			SetHeader("Accept", "application/json").
+			SetTLSClientConfig(&tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}),
+	}, nil
+}
+
+// Login opens a session, authenticated with the API key
+func (c *Client) Login(ctx context.Context) error {
+	body := map[string]string{"authenticationkey": c.cfg.APIKey}
+	if c.cfg.Domain != "" {
+		body["domain"] = c.cfg.Domain
+	}
+
+	resp, err := c.http.R().SetContext(ctx).SetBody(body).Post(c.BaseURL + "/login")
+	if err := checkResponse(resp, err); err != nil {
+		return fmt.Errorf("%w: %v", ErrLogin, err)
+	}
+	Logger.Infof("Logged in to the SMC %s", c.BaseURL)
+	return nil
+}
+
+func (c *Client) Logout(ctx context.Context) error {
+	resp, err := c.http.R().SetContext(ctx).Put(c.BaseURL + "/logout")
+	return checkResponse(resp, err)
+}
+
+// url returns the absolute URL of path, hrefs returned by the SMC being absolute
+func (c *Client) url(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return c.BaseURL + "/" + strings.TrimPrefix(path, "/")
+}
+
+func (c *Client) get(ctx context.Context, path string, result interface{}) error {
+	resp, err := c.http.R().SetContext(ctx).SetResult(result).Get(c.url(path))
+	return checkResponse(resp, err)
+}
+
+func checkResponse(resp *resty.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		e := &StatusError{
+			Method:     resp.Request.Method,
+			URL:        resp.Request.URL,
+			StatusCode: resp.StatusCode(),
+			Status:     resp.Status(),
+		}
+		// SMC errors come as {"details": [...], "message": "..."}
+		var body struct {
+			Message string   `json:"message"`
+			Details []string `json:"details"`
+		}
+		if jsonErr := json.Unmarshal(resp.Body(), &body); jsonErr == nil {
+			e.Details = strings.TrimSpace(body.Message + " " + strings.Join(body.Details, ", "))
+		}
+		return e
+	}
+	return nil
+}
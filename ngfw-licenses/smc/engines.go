@@ -0,0 +1,132 @@
+package smc
+
+import (
+	"context"
+)
+
+//=================================================================
+// Engines
+
+const EnginesPath = "/elements/engine_clusters"
+
+// Engine is a firewall engine, made of one or more nodes
+type Engine struct {
+	Name  string
+	Href  string
+	Type  string
+	Nodes []Node
+}
+
+// Node is an engine node. ProofOfSerial, SerialNumber and ProductName are known
+// once the appliance contacted the SMC, ManagementAddress is the address of its
+// primary management interface.
+type Node struct {
+	Engine            string
+	Name              string
+	Href              string
+	NodeID            int
+	ProofOfSerial     string
+	SerialNumber      string
+	ProductName       string
+	ManagementAddress string
+	BindHref          string
+}
+
+// String returns the engine and node names
+func (n Node) String() string {
+	return n.Engine + "/" + n.Name
+}
+
+type link struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+func findLink(links []link, rel string) string {
+	for _, l := range links {
+		if l.Rel == rel {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// Engines returns the engines of the SMC, with their nodes and appliance info
+func (c *Client) Engines(ctx context.Context) ([]Engine, error) {
+	var list struct {
+		Result []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+			Type string `json:"type"`
+		} `json:"result"`
+	}
+	if err := c.get(ctx, EnginesPath, &list); err != nil {
+		return nil, err
+	}
+
+	res := make([]Engine, 0, len(list.Result))
+	for _, e := range list.Result {
+		engine := Engine{Name: e.Name, Href: e.Href, Type: e.Type}
+
+		var detail struct {
+			// nodes are keyed by their type: firewall_node, virtual_fw_node...
+			Nodes []map[string]struct {
+				Name   string `json:"name"`
+				NodeID int    `json:"nodeid"`
+				Link   []link `json:"link"`
+			} `json:"nodes"`
+			PhysicalInterfaces []struct {
+				PhysicalInterface struct {
+					// interfaces are keyed by their type: single_node_interface, node_interface...
+					Interfaces []map[string]struct {
+						Address    string `json:"address"`
+						NodeID     int    `json:"nodeid"`
+						PrimaryMgt bool   `json:"primary_mgt"`
+					} `json:"interfaces"`
+				} `json:"physical_interface"`
+			} `json:"physicalInterfaces"`
+		}
+		if err := c.get(ctx, e.Href, &detail); err != nil {
+			return nil, err
+		}
+
+		managementAddresses := make(map[int]string)
+		for _, pi := range detail.PhysicalInterfaces {
+			for _, typedInterface := range pi.PhysicalInterface.Interfaces {
+				for _, i := range typedInterface {
+					if i.PrimaryMgt {
+						managementAddresses[i.NodeID] = i.Address
+					}
+				}
+			}
+		}
+
+		for _, typedNode := range detail.Nodes {
+			for _, n := range typedNode {
+				node := Node{
+					Engine:            e.Name,
+					Name:              n.Name,
+					NodeID:            n.NodeID,
+					Href:              findLink(n.Link, "self"),
+					BindHref:          findLink(n.Link, "bind"),
+					ManagementAddress: managementAddresses[n.NodeID],
+				}
+				if href := findLink(n.Link, "appliance_info"); href != "" {
+					var info struct {
+						ProofOfSerial string `json:"proof_of_serial"`
+						SerialNumber  string `json:"serial_number"`
+						ProductName   string `json:"product_name"`
+					}
+					// nodes which never contacted the SMC have no appliance info
+					if err := c.get(ctx, href, &info); err == nil {
+						node.ProofOfSerial, node.SerialNumber, node.ProductName = info.ProofOfSerial, info.SerialNumber, info.ProductName
+					}
+				}
+				engine.Nodes = append(engine.Nodes, node)
+			}
+		}
+		res = append(res, engine)
+	}
+
+	return res, nil
+}
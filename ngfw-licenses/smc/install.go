@@ -0,0 +1,106 @@
+package smc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+//=================================================================
+// Install
+
+var ErrNoNode = errors.New("no engine node found")
+
+// Install uploads to the SMC the license files found in dir for the Registered
+// PoS/PoL, unless already installed, and binds the licenses to the node
+// mapping gives, a nil mapping being proposed from the SMC engines. PoL
+// licenses left unmatched are bound by the SMC from their IP binding.
+// Cancelling ctx skips the PoS/PoL not yet started.
+func Install(ctx context.Context, c *Client, poxList pox.PoXList, dir string, mapping *Mapping) (*pox.Report, error) {
+	report := &pox.Report{Action: pox.ActionInstall, Start: time.Now(), Results: make([]pox.Result, 0)}
+
+	licenses, err := c.Licenses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]License, len(licenses))
+	for _, l := range licenses {
+		installed[l.LicenseID] = l
+	}
+	engines, err := c.Engines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mapping == nil {
+		mapping = NewMapping(engines, poxList)
+	}
+
+	skipped := 0
+	for _, p := range poxList {
+		if p.Status != statutes.Registered || p.LicenseFile == "" {
+			continue
+		}
+
+		res := pox.Result{PoX: p, Action: pox.ActionInstall, Before: p.State(), After: p.State()}
+		if ctx.Err() != nil {
+			res.Skipped = true
+			report.Results = append(report.Results, res)
+			skipped++
+			continue
+		}
+
+		start := time.Now()
+		res.Changed, res.Err = install(ctx, c, p, dir, installed, engines, mapping)
+		res.Duration = time.Since(start)
+		if res.Err != nil {
+			Logger.Errorf("%v", res.Err)
+		}
+		report.Results = append(report.Results, res)
+	}
+	report.Duration = time.Since(report.Start)
+
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("%w: %d PoS/PoL skipped", pox.ErrInterrupted, skipped)
+	}
+	return report, nil
+}
+
+func install(ctx context.Context, c *Client, p *pox.PoX, dir string, installed map[string]License, engines []Engine, mapping *Mapping) (changed bool, err error) {
+	l, ok := installed[p.LicenseID]
+	if !ok {
+		data, err := ioutil.ReadFile(filepath.Join(dir, p.LicenseFile))
+		if err != nil {
+			return false, fmt.Errorf("install %s: %w", p.Identifier(), err)
+		}
+		if err := c.InstallLicense(ctx, p.LicenseFile, data); err != nil {
+			return false, fmt.Errorf("install %s: %w", p.Identifier(), err)
+		}
+		Logger.Infof("%s license file %s installed", p.Identifier(), p.LicenseFile)
+		changed = true
+		l = License{LicenseID: p.LicenseID}
+	}
+
+	if l.Bound() {
+		return changed, nil
+	}
+
+	node, err := mapping.Node(engines, p.Identifier())
+	if p.Type() == pox.PoL && errors.Is(err, ErrNoNode) {
+		return changed, nil
+	}
+	if err != nil {
+		return changed, fmt.Errorf("bind %s: %w", p.Identifier(), err)
+	}
+	if err := c.BindLicense(ctx, node, p.LicenseID); err != nil {
+		return changed, fmt.Errorf("bind %s: %w", p.Identifier(), err)
+	}
+	Logger.Infof("%s license %s bound to %s", p.Identifier(), p.LicenseID, node)
+
+	return true, nil
+}
@@ -0,0 +1,174 @@
+package smc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/smc/smctest"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+const (
+	testAPIKey = "0123456789abcdef"
+	testPoS1   = "0123456789-abcdef0123"
+	testPoS2   = "1111111111-2222222222"
+	testPoS3   = "3333333333-4444444444"
+	testPoL1   = "01234-56789-abcde-f0123"
+)
+
+func TestMain(m *testing.M) {
+	Logger = config.GetNewLogger("SMC   ")
+	os.Exit(m.Run())
+}
+
+// newRegistered returns a Registered PoS/PoL whose license file is written in
+// dir, and known to srv
+func newRegistered(t *testing.T, srv *smctest.Server, dir string, new func(string) (*pox.PoX, error), id, licenseID string) *pox.PoX {
+	t.Helper()
+	p, err := new(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Status, p.LicenseID, p.LicenseFile = statutes.Registered, licenseID, licenseID+".jar"
+
+	// the content is opaque to the installation
+	data := []byte("license file " + licenseID + " for " + id)
+	if err := ioutil.WriteFile(filepath.Join(dir, p.LicenseFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv.AddLicenseFile(data, smctest.License{LicenseID: licenseID, Type: "NGFW", Binding: id, ExpirationDate: "2023-12-22"})
+
+	return p
+}
+
+func newTestServer(t *testing.T) (*smctest.Server, *Client) {
+	srv := smctest.NewServer(testAPIKey)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(srv.Config())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if err := c.Login(context.Background()); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	return srv, c
+}
+
+func TestClient_Login(t *testing.T) {
+	srv := smctest.NewServer(testAPIKey)
+	defer srv.Close()
+
+	cfg := srv.Config()
+	cfg.APIKey = "wrong"
+	c, _ := NewClient(cfg)
+	if err := c.Login(context.Background()); !errors.Is(err, ErrLogin) {
+		t.Errorf("Login() error = %v, want %v", err, ErrLogin)
+	}
+
+	if _, err := c.Licenses(context.Background()); err == nil {
+		t.Errorf("Licenses() without session error = nil, want an error")
+	}
+
+	if _, err := NewClient(nil); !errors.Is(err, ErrMissingConfig) {
+		t.Errorf("NewClient(nil) error = %v, want %v", err, ErrMissingConfig)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry-run=%v", dryRun), func(t *testing.T) {
+			srv, c := newTestServer(t)
+			c.DryRun = dryRun
+			srv.AddEngine(smctest.Engine{Name: "fw-paris", Nodes: []smctest.Node{
+				{Name: "node 1", ProofOfSerial: testPoS1, ProductName: "NGFW 120W"},
+				{Name: "node 2"},
+			}})
+			srv.AddLicense(smctest.License{LicenseID: "700003", Binding: testPoS3, BindingState: "Bound", BoundTo: "fw-lyon node 1"})
+
+			dir, err := ioutil.TempDir("", "smc-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			purchased, _ := pox.NewPoS("5555555555-5555555555")
+			purchased.Status = statutes.Purchased
+			poxList := pox.PoXList{
+				newRegistered(t, srv, dir, pox.NewPoS, testPoS1, "700001"),
+				newRegistered(t, srv, dir, pox.NewPoS, testPoS2, "700002"),
+				newRegistered(t, srv, dir, pox.NewPoS, testPoS3, "700003"),
+				newRegistered(t, srv, dir, pox.NewPoL, testPoL1, "700004"),
+				purchased,
+			}
+
+			report, err := Install(context.Background(), c, poxList, dir, nil)
+			if err != nil {
+				t.Fatalf("Install() error = %v", err)
+			}
+
+			// PoS2 has no node, PoS3 is already installed and bound
+			if got := len(report.Results); got != 4 {
+				t.Errorf("%d results, want 4", got)
+			}
+			failed := report.Failed()
+			if len(failed) != 1 || failed[0].PoX.Identifier() != testPoS2 || !errors.Is(failed[0].Err, ErrNoNode) {
+				t.Errorf("Failed() = %+v, want %s without node", failed, testPoS2)
+			}
+			if got := len(report.Changed()); got != 2 {
+				t.Errorf("len(Changed()) = %d, want 2", got)
+			}
+
+			if dryRun {
+				if got := srv.Uploads(); len(got) != 0 {
+					t.Errorf("Uploads() = %v in dry-run", got)
+				}
+				if got := srv.Requests("POST", "/elements/engine/0/node/0/bind"); got != 0 {
+					t.Errorf("%d bind in dry-run", got)
+				}
+				return
+			}
+
+			if got := srv.Uploads(); len(got) != 3 {
+				t.Errorf("Uploads() = %v, want 3 files", got)
+			}
+			for _, l := range srv.Licenses() {
+				wantBound := l.LicenseID == "700001" || l.LicenseID == "700003"
+				if (l.BindingState == "Bound") != wantBound {
+					t.Errorf("license %s BindingState = %q, BoundTo = %q", l.LicenseID, l.BindingState, l.BoundTo)
+				}
+				if l.LicenseID == "700001" && l.BoundTo != "fw-paris node 1" {
+					t.Errorf("license 700001 BoundTo = %q, want %q", l.BoundTo, "fw-paris node 1")
+				}
+			}
+		})
+	}
+}
+
+func TestInstall_InvalidFile(t *testing.T) {
+	srv, c := newTestServer(t)
+	srv.AddEngine(smctest.Engine{Name: "fw-paris", Nodes: []smctest.Node{{Name: "node 1", ProofOfSerial: testPoS1}}})
+	dir := t.TempDir()
+
+	// the SMC rejects a file which is not a license file
+	p := newRegistered(t, srv, dir, pox.NewPoS, testPoS1, "700001")
+	ioutil.WriteFile(filepath.Join(dir, p.LicenseFile), []byte("<html>Session expired</html>"), 0644)
+
+	report, err := Install(context.Background(), c, pox.PoXList{p}, dir, nil)
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if failed := report.Failed(); len(failed) != 1 {
+		t.Errorf("Failed() = %+v, want the invalid file", failed)
+	}
+	if got := srv.Uploads(); len(got) != 0 {
+		t.Errorf("Uploads() = %v, want none", got)
+	}
+}
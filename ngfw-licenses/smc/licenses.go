@@ -0,0 +1,83 @@
+package smc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+//=================================================================
+// Licenses
+
+const (
+	LicensesPath       = "/system/licenses"
+	LicenseInstallPath = "/system/license_install"
+)
+
+// License is a license installed on the SMC
+type License struct {
+	LicenseID      string `json:"license_id"`
+	Type           string `json:"type"`
+	Binding        string `json:"binding"`
+	ProofOfLicense string `json:"proof_of_license"`
+	ProofOfSerial  string `json:"proof_of_serial"`
+	ExpirationDate string `json:"expiration_date"`
+	// BindingState is Bound or Unassigned, BoundTo being the node name
+	BindingState string `json:"binding_state"`
+	BoundTo      string `json:"bound_to"`
+	Features     string `json:"features"`
+}
+
+const BindingStateBound = "Bound"
+
+func (l License) Bound() bool {
+	return l.BindingState == BindingStateBound
+}
+
+// Licenses returns the licenses installed on the SMC
+func (c *Client) Licenses(ctx context.Context) ([]License, error) {
+	var result struct {
+		License []License `json:"license"`
+	}
+	if err := c.get(ctx, LicensesPath, &result); err != nil {
+		return nil, err
+	}
+	return result.License, nil
+}
+
+// InstallLicense uploads a license file
+func (c *Client) InstallLicense(ctx context.Context, filename string, data []byte) error {
+	if c.DryRun {
+		Logger.Infof("Dry-run: %s not uploaded", filename)
+		return nil
+	}
+
+	resp, err := c.http.R().
+		SetContext(ctx).
+		SetFileReader("license_file", filename, bytes.NewReader(data)).
+		Post(c.url(LicenseInstallPath))
+	if err := checkResponse(resp, err); err != nil {
+		return fmt.Errorf("unable to install %s: %w", filename, err)
+	}
+	return nil
+}
+
+// BindLicense binds an installed license to an engine node
+func (c *Client) BindLicense(ctx context.Context, node Node, licenseID string) error {
+	if node.BindHref == "" {
+		return fmt.Errorf("node %s cannot be bound", node.Name)
+	}
+	if c.DryRun {
+		Logger.Infof("Dry-run: license %s not bound to %s", licenseID, node.Name)
+		return nil
+	}
+
+	resp, err := c.http.R().
+		SetContext(ctx).
+		SetQueryParam("license_item_id", licenseID).
+		Post(c.url(node.BindHref))
+	if err := checkResponse(resp, err); err != nil {
+		return fmt.Errorf("unable to bind license %s to %s: %w", licenseID, node.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package smc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/logrusorgru/aurora"
+)
+
+//=================================================================
+// Matcher
+
+var ErrAmbiguousNode = errors.New("several engine nodes found")
+
+// MatchStatus tells how a PoS/PoL has been matched to an engine node
+type MatchStatus string
+
+const (
+	Matched   MatchStatus = "matched"
+	Unmatched MatchStatus = "unmatched"
+	Ambiguous MatchStatus = "ambiguous"
+	// Manual matches have been set by hand in the mapping file, they are kept
+	// when the mapping is proposed again
+	Manual MatchStatus = "manual"
+)
+
+// Match is the engine node proposed for a PoS/PoL. Candidates lists the nodes
+// which could not be told apart for Ambiguous matches.
+type Match struct {
+	PoX          string      `json:"pox"`
+	Type         pox.PoXType `json:"type"`
+	SerialNumber string      `json:"serial_number,omitempty"`
+	ProductName  string      `json:"product_name,omitempty"`
+	Binding      string      `json:"binding,omitempty"`
+	Engine       string      `json:"engine,omitempty"`
+	Node         string      `json:"node,omitempty"`
+	Status       MatchStatus `json:"status"`
+	By           string      `json:"matched_by,omitempty"`
+	Candidates   []string    `json:"candidates,omitempty"`
+}
+
+// Mapping gathers the engine nodes proposed for a list of PoS/PoL, it is saved
+// for the install step to bind the licenses
+type Mapping struct {
+	Date    time.Time `json:"date"`
+	Matches []Match   `json:"matches"`
+}
+
+// NewMapping proposes an engine node for every PoS/PoL:
+//   - a PoS matches the node whose appliance has the same proof of serial or
+//     serial number, or else the only node of the same product without
+//     appliance info
+//   - a PoL matches the node whose primary management address is its binding
+//
+// A node proposed for several PoS/PoL is flagged ambiguous for all of them.
+func NewMapping(engines []Engine, poxList pox.PoXList) *Mapping {
+	nodes := make([]Node, 0)
+	for _, e := range engines {
+		nodes = append(nodes, e.Nodes...)
+	}
+
+	m := &Mapping{Date: time.Now(), Matches: make([]Match, 0, len(poxList))}
+	claims := make(map[string]int)
+	for _, p := range poxList {
+		match := Match{
+			PoX:          p.Identifier(),
+			Type:         p.Type(),
+			SerialNumber: p.SerialNumber,
+			ProductName:  p.ProductName,
+			Binding:      p.Binding,
+		}
+		candidates, by := candidateNodes(nodes, p)
+		match.set(candidates, by)
+		if match.Status == Matched {
+			claims[match.node()]++
+		}
+		m.Matches = append(m.Matches, match)
+	}
+
+	for i, match := range m.Matches {
+		if match.Status == Matched && claims[match.node()] > 1 {
+			m.Matches[i].Status = Ambiguous
+			m.Matches[i].Candidates = []string{match.node()}
+			m.Matches[i].Engine, m.Matches[i].Node = "", ""
+		}
+	}
+
+	m.sort()
+	return m
+}
+
+func candidateNodes(nodes []Node, p *pox.PoX) ([]Node, string) {
+	if p.Type() == pox.PoL {
+		return filterNodes(nodes, func(n Node) bool {
+			return p.Binding != "" && n.ManagementAddress == p.Binding
+		}), "management address"
+	}
+
+	if res := filterNodes(nodes, func(n Node) bool { return strings.EqualFold(n.ProofOfSerial, p.Identifier()) }); len(res) > 0 {
+		return res, "proof of serial"
+	}
+	if res := filterNodes(nodes, func(n Node) bool {
+		return p.SerialNumber != "" && strings.EqualFold(n.SerialNumber, p.SerialNumber)
+	}); len(res) > 0 {
+		return res, "serial number"
+	}
+	// nodes which never contacted the SMC are only known by their product
+	return filterNodes(nodes, func(n Node) bool {
+		return n.ProofOfSerial == "" && n.SerialNumber == "" &&
+			p.ProductName != "" && strings.EqualFold(n.ProductName, p.ProductName)
+	}), "product name"
+}
+
+func filterNodes(nodes []Node, fct func(Node) bool) (res []Node) {
+	res = make([]Node, 0)
+	for _, n := range nodes {
+		if fct(n) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func (m *Match) set(candidates []Node, by string) {
+	switch len(candidates) {
+	case 0:
+		m.Status = Unmatched
+	case 1:
+		m.Status, m.By = Matched, by
+		m.Engine, m.Node = candidates[0].Engine, candidates[0].Name
+	default:
+		m.Status, m.By = Ambiguous, by
+		for _, n := range candidates {
+			m.Candidates = append(m.Candidates, n.String())
+		}
+	}
+}
+
+func (m Match) node() string {
+	return m.Engine + "/" + m.Node
+}
+
+// Merge keeps the Manual matches of previous, the PoS/PoL only known by
+// previous are kept as well
+func (m *Mapping) Merge(previous *Mapping) {
+	if previous == nil {
+		return
+	}
+	for _, match := range previous.Matches {
+		i, ok := m.index(match.PoX)
+		switch {
+		case !ok:
+			m.Matches = append(m.Matches, match)
+		case match.Status == Manual:
+			m.Matches[i] = match
+		}
+	}
+	m.sort()
+}
+
+// Get returns the match of a PoS/PoL
+func (m *Mapping) Get(id string) (Match, bool) {
+	if m == nil {
+		return Match{}, false
+	}
+	i, ok := m.index(id)
+	if !ok {
+		return Match{}, false
+	}
+	return m.Matches[i], true
+}
+
+// Node returns the engine node a PoS/PoL is mapped to, ErrNoNode when it is
+// unmatched or its node no longer exists, and ErrAmbiguousNode when several
+// nodes are candidates
+func (m *Mapping) Node(engines []Engine, id string) (Node, error) {
+	match, ok := m.Get(id)
+	if !ok || match.Status == Unmatched {
+		return Node{}, ErrNoNode
+	}
+	if match.Status == Ambiguous {
+		return Node{}, fmt.Errorf("%w: %s", ErrAmbiguousNode, strings.Join(match.Candidates, ", "))
+	}
+	for _, e := range engines {
+		for _, n := range e.Nodes {
+			if n.Engine == match.Engine && n.Name == match.Node {
+				return n, nil
+			}
+		}
+	}
+	return Node{}, fmt.Errorf("%w: %s/%s", ErrNoNode, match.Engine, match.Node)
+}
+
+// Count returns the number of matches having status
+func (m *Mapping) Count(status MatchStatus) (res int) {
+	for _, match := range m.Matches {
+		if match.Status == status {
+			res++
+		}
+	}
+	return res
+}
+
+func (m *Mapping) index(id string) (int, bool) {
+	for i, match := range m.Matches {
+		if match.PoX == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (m *Mapping) sort() {
+	sort.SliceStable(m.Matches, func(i, j int) bool { return m.Matches[i].PoX < m.Matches[j].PoX })
+}
+
+// Display displays the proposed mapping, unmatched and ambiguous PoS/PoL first
+func (m *Mapping) Display() {
+	for _, status := range []MatchStatus{Unmatched, Ambiguous, Matched, Manual} {
+		if m.Count(status) == 0 {
+			continue
+		}
+		fmt.Printf("\n%d %s PoS/PoL:\n", m.Count(status), status)
+		for _, match := range m.Matches {
+			if match.Status != status {
+				continue
+			}
+			switch status {
+			case Unmatched:
+				key := match.SerialNumber
+				if match.Type == pox.PoL {
+					key = match.Binding
+				}
+				fmt.Printf("- %s %s %s\n", match.PoX, aurora.Gray(12, match.ProductName), aurora.Yellow(key))
+			case Ambiguous:
+				fmt.Printf("- %s -> %s (%s)\n", match.PoX, aurora.Yellow(strings.Join(match.Candidates, ", ")), match.By)
+			default:
+				fmt.Printf("- %s -> %s/%s %s\n", match.PoX, aurora.Green(match.Engine), aurora.Green(match.Node), aurora.Gray(12, match.By))
+			}
+		}
+	}
+}
+
+// ReadMapping reads a mapping file, a missing file gives a nil Mapping
+func ReadMapping(path string) (*Mapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mapping{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid mapping file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Save writes the mapping file
+func (m *Mapping) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,174 @@
+package smc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/pox"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/smc/smctest"
+	"github.com/Newlode/forcepoint-ngfw-licenses/ngfw-licenses/statutes"
+)
+
+func TestNewMapping(t *testing.T) {
+	srv, c := newTestServer(t)
+	srv.AddEngine(smctest.Engine{Name: "fw-paris", Nodes: []smctest.Node{
+		// the SMC may give the PoS upper-cased
+		{Name: "node 1", ProofOfSerial: strings.ToUpper(testPoS1), ProductName: "NGFW 120W"},
+		{Name: "node 2", SerialNumber: "N2SERIAL", ProductName: "NGFW 120W", ManagementAddress: "10.0.0.2"},
+	}})
+	srv.AddEngine(smctest.Engine{Name: "fw-lyon", Nodes: []smctest.Node{
+		{Name: "node 1", ProductName: "NGFW 1101"},
+		{Name: "node 2", ProductName: "NGFW 1101"},
+		{Name: "node 3", ProductName: "NGFW 2201"},
+		{Name: "node 4", ManagementAddress: "10.0.1.4"},
+	}})
+
+	engines, err := c.Engines(context.Background())
+	if err != nil {
+		t.Fatalf("Engines() error = %v", err)
+	}
+	if n := engines[0].Nodes[1]; n.SerialNumber != "N2SERIAL" || n.ManagementAddress != "10.0.0.2" {
+		t.Fatalf("Engines() node 2 = %#v", n)
+	}
+
+	newPoX := func(new func(string) (*pox.PoX, error), id, serial, product, binding string) *pox.PoX {
+		p, err := new(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Status, p.SerialNumber, p.ProductName, p.Binding = statutes.Registered, serial, product, binding
+		return p
+	}
+	poxList := pox.PoXList{
+		newPoX(pox.NewPoS, testPoS1, "", "NGFW 120W", testPoS1),
+		newPoX(pox.NewPoS, testPoS2, "n2serial", "NGFW 120W", testPoS2),
+		newPoX(pox.NewPoS, testPoS3, "", "NGFW 1101", testPoS3),
+		newPoX(pox.NewPoS, "5555555555-5555555555", "", "NGFW 2201", "5555555555-5555555555"),
+		newPoX(pox.NewPoS, "6666666666-6666666666", "UNKNOWN", "NGFW 3301", "6666666666-6666666666"),
+		newPoX(pox.NewPoL, testPoL1, "", "NGFW Virtual", "10.0.1.4"),
+		newPoX(pox.NewPoL, "11111-22222-33333-44444", "", "NGFW Virtual", "10.9.9.9"),
+	}
+
+	m := NewMapping(engines, poxList)
+	want := map[string]Match{
+		testPoS1:                  {Engine: "fw-paris", Node: "node 1", Status: Matched, By: "proof of serial"},
+		testPoS2:                  {Engine: "fw-paris", Node: "node 2", Status: Matched, By: "serial number"},
+		testPoS3:                  {Status: Ambiguous, By: "product name", Candidates: []string{"fw-lyon/node 1", "fw-lyon/node 2"}},
+		"5555555555-5555555555":   {Engine: "fw-lyon", Node: "node 3", Status: Matched, By: "product name"},
+		"6666666666-6666666666":   {Status: Unmatched},
+		testPoL1:                  {Engine: "fw-lyon", Node: "node 4", Status: Matched, By: "management address"},
+		"11111-22222-33333-44444": {Status: Unmatched},
+	}
+	if len(m.Matches) != len(want) {
+		t.Fatalf("%d matches, want %d", len(m.Matches), len(want))
+	}
+	for id, w := range want {
+		got, ok := m.Get(id)
+		if !ok {
+			t.Errorf("Get(%s) not found", id)
+			continue
+		}
+		if got.Engine != w.Engine || got.Node != w.Node || got.Status != w.Status || got.By != w.By || !reflect.DeepEqual(got.Candidates, w.Candidates) {
+			t.Errorf("Get(%s) = %+v, want %+v", id, got, w)
+		}
+	}
+
+	if _, err := m.Node(engines, testPoS3); !errors.Is(err, ErrAmbiguousNode) {
+		t.Errorf("Node(%s) error = %v, want %v", testPoS3, err, ErrAmbiguousNode)
+	}
+	if n, err := m.Node(engines, testPoS2); err != nil || n.String() != "fw-paris/node 2" {
+		t.Errorf("Node(%s) = %v, %v", testPoS2, n, err)
+	}
+
+	// a node proposed for two PoS is ambiguous for both
+	twice := NewMapping(engines, pox.PoXList{
+		newPoX(pox.NewPoS, testPoS1, "", "", ""),
+		newPoX(pox.NewPoS, testPoS2, "", "NGFW 2201", ""),
+		newPoX(pox.NewPoS, testPoS3, "", "NGFW 2201", ""),
+	})
+	if got := twice.Count(Ambiguous); got != 2 {
+		t.Errorf("Count(Ambiguous) = %d, want 2", got)
+	}
+}
+
+func TestMapping_SaveMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mapping.json")
+
+	if m, err := ReadMapping(path); m != nil || err != nil {
+		t.Fatalf("ReadMapping() of a missing file = %v, %v", m, err)
+	}
+
+	previous := &Mapping{Matches: []Match{
+		{PoX: testPoS1, Type: pox.PoS, Status: Matched, Engine: "fw-old", Node: "node 1"},
+		{PoX: testPoS2, Type: pox.PoS, Status: Manual, Engine: "fw-paris", Node: "node 2"},
+		{PoX: testPoS3, Type: pox.PoS, Status: Unmatched},
+	}}
+	if err := previous.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	read, err := ReadMapping(path)
+	if err != nil {
+		t.Fatalf("ReadMapping() error = %v", err)
+	}
+
+	m := &Mapping{Matches: []Match{
+		{PoX: testPoS1, Type: pox.PoS, Status: Matched, Engine: "fw-paris", Node: "node 1"},
+		{PoX: testPoS2, Type: pox.PoS, Status: Unmatched},
+	}}
+	m.Merge(read)
+
+	// proposed matches replace the previous ones, except manual ones
+	want := []Match{
+		{PoX: testPoS1, Type: pox.PoS, Status: Matched, Engine: "fw-paris", Node: "node 1"},
+		{PoX: testPoS2, Type: pox.PoS, Status: Manual, Engine: "fw-paris", Node: "node 2"},
+		{PoX: testPoS3, Type: pox.PoS, Status: Unmatched},
+	}
+	if !reflect.DeepEqual(m.Matches, want) {
+		t.Errorf("Merge() = %+v, want %+v", m.Matches, want)
+	}
+}
+
+func TestInstall_Mapping(t *testing.T) {
+	srv, c := newTestServer(t)
+	srv.AddEngine(smctest.Engine{Name: "fw-paris", Nodes: []smctest.Node{{Name: "node 1"}, {Name: "node 2"}}})
+
+	dir, err := ioutil.TempDir("", "smc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	poxList := pox.PoXList{
+		newRegistered(t, srv, dir, pox.NewPoS, testPoS1, "700001"),
+		newRegistered(t, srv, dir, pox.NewPoL, testPoL1, "700004"),
+	}
+	mapping := &Mapping{Matches: []Match{
+		{PoX: testPoS1, Type: pox.PoS, Status: Manual, Engine: "fw-paris", Node: "node 2"},
+		{PoX: testPoL1, Type: pox.PoL, Status: Matched, Engine: "fw-paris", Node: "node 1"},
+	}}
+
+	report, err := Install(context.Background(), c, poxList, dir, mapping)
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if got := len(report.Changed()); got != 2 {
+		t.Errorf("len(Changed()) = %d, want 2, failed: %+v", got, report.Failed())
+	}
+	for _, l := range srv.Licenses() {
+		want := map[string]string{"700001": "fw-paris node 2", "700004": "fw-paris node 1"}[l.LicenseID]
+		if l.BoundTo != want {
+			t.Errorf("license %s BoundTo = %q, want %q", l.LicenseID, l.BoundTo, want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Package smctest provides a fake Security Management Center REST API for
+// tests, in the spirit of net/http/httptest.
+package smctest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Newlode/forcepoint-ngfw-licenses/config"
+)
+
+const (
+	APIVersion    = "6.10"
+	sessionCookie = "JSESSIONID"
+	sessionID     = "smctest-session"
+)
+
+//=================================================================
+// Elements
+
+// Node is an engine node, nodes without ProofOfSerial, SerialNumber nor
+// ProductName have no appliance info
+type Node struct {
+	Name              string
+	ProofOfSerial     string
+	SerialNumber      string
+	ProductName       string
+	ManagementAddress string
+}
+
+type Engine struct {
+	Name  string
+	Type  string
+	Nodes []Node
+}
+
+// License is a license installed on the SMC
+type License struct {
+	LicenseID      string `json:"license_id"`
+	Type           string `json:"type"`
+	Binding        string `json:"binding"`
+	ProofOfLicense string `json:"proof_of_license,omitempty"`
+	ProofOfSerial  string `json:"proof_of_serial,omitempty"`
+	ExpirationDate string `json:"expiration_date"`
+	BindingState   string `json:"binding_state"`
+	BoundTo        string `json:"bound_to,omitempty"`
+	Features       string `json:"features,omitempty"`
+}
+
+//=================================================================
+// Server
+
+// Server is a fake SMC, serving login, logout, engine_clusters, the engines
+// and their nodes, system/licenses and system/license_install
+type Server struct {
+	*httptest.Server
+	APIKey string
+
+	mu       sync.Mutex
+	engines  []*Engine
+	licenses []*License
+	files    map[string]License
+	uploads  []string
+	requests map[string]int
+}
+
+// NewServer starts a Server accepting apiKey, to be closed by the caller
+func NewServer(apiKey string) *Server {
+	s := &Server{APIKey: apiKey, files: make(map[string]License), requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config returns the smc config section to reach the server
+func (s *Server) Config() *config.SMC {
+	host, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &config.SMC{IP: host, Port: p, APIKey: s.APIKey, APIVersion: APIVersion}
+}
+
+func (s *Server) AddEngine(e Engine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.Type == "" {
+		e.Type = "single_fw"
+	}
+	s.engines = append(s.engines, &e)
+}
+
+func (s *Server) AddLicense(l License) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.licenses = append(s.licenses, &l)
+}
+
+// AddLicenseFile tells the license the SMC reads from the license file data,
+// the uploads of other files being rejected. The content of license files is
+// not parsed: their layout is the one of the real portal, not known here.
+func (s *Server) AddLicenseFile(data []byte, l License) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[fileKey(data)] = l
+}
+
+// Licenses returns a copy of the installed licenses
+func (s *Server) Licenses() []License {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]License, 0, len(s.licenses))
+	for _, l := range s.licenses {
+		res = append(res, *l)
+	}
+	return res
+}
+
+// Uploads returns the names of the license files uploaded
+func (s *Server) Uploads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.uploads...)
+}
+
+// Requests returns the number of requests received with the given method on
+// the given path, relative to the API version
+func (s *Server) Requests(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[method+" "+path]
+}
+
+//=================================================================
+// Handlers
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+APIVersion)
+	s.requests[r.Method+" "+path]++
+
+	if path == "/login" && r.Method == http.MethodPost {
+		s.handleLogin(w, r)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err != nil || c.Value != sessionID {
+		writeError(w, http.StatusUnauthorized, "Not logged in")
+		return
+	}
+
+	switch {
+	case path == "/logout" && r.Method == http.MethodPut:
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/elements/engine_clusters" && r.Method == http.MethodGet:
+		s.handleEngines(w)
+	case strings.HasPrefix(path, "/elements/engine/"):
+		s.handleEngine(w, r, strings.Split(strings.TrimPrefix(path, "/elements/engine/"), "/"))
+	case path == "/system/licenses" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{"license": s.licenses})
+	case path == "/system/license_install" && r.Method == http.MethodPost:
+		s.handleLicenseInstall(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		AuthenticationKey string `json:"authenticationkey"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AuthenticationKey != s.APIKey {
+		writeError(w, http.StatusUnauthorized, "Login failed")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: sessionID, Path: "/"})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) href(format string, args ...interface{}) string {
+	return s.URL + "/" + APIVersion + fmt.Sprintf(format, args...)
+}
+
+func (s *Server) handleEngines(w http.ResponseWriter) {
+	result := make([]map[string]string, 0, len(s.engines))
+	for i, e := range s.engines {
+		result = append(result, map[string]string{"name": e.Name, "type": e.Type, "href": s.href("/elements/engine/%d", i)})
+	}
+	writeJSON(w, map[string]interface{}{"result": result})
+}
+
+// handleEngine serves engine/<i>, engine/<i>/node/<j>/appliance_info and
+// engine/<i>/node/<j>/bind
+func (s *Server) handleEngine(w http.ResponseWriter, r *http.Request, parts []string) {
+	var i, j int
+	if _, err := fmt.Sscanf(parts[0], "%d", &i); err != nil || i >= len(s.engines) {
+		writeError(w, http.StatusNotFound, "Unknown engine")
+		return
+	}
+	engine := s.engines[i]
+
+	if len(parts) == 1 {
+		nodes := make([]map[string]interface{}, 0, len(engine.Nodes))
+		interfaces := make([]map[string]interface{}, 0, len(engine.Nodes))
+		for j, n := range engine.Nodes {
+			if n.ManagementAddress != "" {
+				interfaces = append(interfaces, map[string]interface{}{"node_interface": map[string]interface{}{
+					"address": n.ManagementAddress, "nodeid": j + 1, "primary_mgt": true,
+				}})
+			}
+			nodeHref := s.href("/elements/engine/%d/node/%d", i, j)
+			nodes = append(nodes, map[string]interface{}{"firewall_node": map[string]interface{}{
+				"name":   n.Name,
+				"nodeid": j + 1,
+				"link": []map[string]string{
+					{"rel": "self", "href": nodeHref},
+					{"rel": "appliance_info", "href": nodeHref + "/appliance_info"},
+					{"rel": "bind", "href": nodeHref + "/bind"},
+				},
+			}})
+		}
+		writeJSON(w, map[string]interface{}{
+			"name":  engine.Name,
+			"nodes": nodes,
+			"physicalInterfaces": []map[string]interface{}{
+				{"physical_interface": map[string]interface{}{"interfaces": interfaces}},
+			},
+		})
+		return
+	}
+
+	if len(parts) != 4 || parts[1] != "node" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if _, err := fmt.Sscanf(parts[2], "%d", &j); err != nil || j >= len(engine.Nodes) {
+		writeError(w, http.StatusNotFound, "Unknown node")
+		return
+	}
+	node := engine.Nodes[j]
+
+	switch {
+	case parts[3] == "appliance_info" && r.Method == http.MethodGet:
+		if node.ProofOfSerial == "" && node.SerialNumber == "" && node.ProductName == "" {
+			writeError(w, http.StatusNotFound, "No appliance info")
+			return
+		}
+		writeJSON(w, map[string]string{"proof_of_serial": node.ProofOfSerial, "serial_number": node.SerialNumber, "product_name": node.ProductName})
+	case parts[3] == "bind" && r.Method == http.MethodPost:
+		id := r.URL.Query().Get("license_item_id")
+		for _, l := range s.licenses {
+			if l.LicenseID == id {
+				l.BindingState, l.BoundTo = "Bound", engine.Name+" "+node.Name
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeError(w, http.StatusBadRequest, "Unknown license "+id)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) handleLicenseInstall(w http.ResponseWriter, r *http.Request) {
+	f, header, err := r.FormFile("license_file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Missing license_file")
+		return
+	}
+	data, _ := ioutil.ReadAll(f)
+
+	l, ok := s.files[fileKey(data)]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid license file "+header.Filename)
+		return
+	}
+
+	s.uploads = append(s.uploads, header.Filename)
+	l.BindingState = "Unassigned"
+	s.licenses = append(s.licenses, &l)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//=================================================================
+// Helpers
+
+func fileKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message, "details": []string{}})
+}
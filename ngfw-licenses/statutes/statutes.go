@@ -17,6 +17,7 @@ const (
 	Registered        LicenseStatus = "REGISTERED"
 	Purchased         LicenseStatus = "PURCHASED"
 	RegistrationError LicenseStatus = "REGISTRATION_ERROR"
+	Unreachable       LicenseStatus = "UNREACHABLE"
 	Activated         SupportStatus = "Activated"
 	Expired           SupportStatus = "Expired"
 	Spare             SupportStatus = "Spare"
@@ -24,7 +25,7 @@ const (
 
 var (
 	// LicenseStatuses = []LicenseStatus{Registered, Unregistered, Registering, Unknown, Purchased, Valid, Invalid, RegistrationError}
-	LicenseStatuses = []LicenseStatus{Registered, Unregistered, Registering, Unknown, Purchased, Invalid, RegistrationError}
+	LicenseStatuses = []LicenseStatus{Registered, Unregistered, Registering, Unknown, Purchased, Invalid, RegistrationError, Unreachable}
 )
 
 func (s LicenseStatus) String() string {
@@ -36,6 +37,8 @@ func (s LicenseStatus) String() string {
 	// 	r = aurora.Yellow(string(s))
 	case Invalid:
 		r = aurora.Red(string(s))
+	case Unreachable:
+		r = aurora.Magenta(string(s))
 	case Registered:
 		r = aurora.Green(string(s))
 	default: